@@ -0,0 +1,100 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultConcurrency is the number of operations a bulk operation performs
+// at once if no concurrency is specified
+const DefaultConcurrency = 8
+
+// BatchError describes the failures of a bulk operation. Each error is
+// keyed by the URL of the resource it relates to.
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) urls() []string {
+	k := make([]string, 0, len(e.Errors))
+	for u := range e.Errors {
+		k = append(k, u)
+	}
+	slices.Sort(k)
+	return k
+}
+
+func (e *BatchError) Error() string {
+	urls := e.urls()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d operations failed", len(urls))
+	for i, u := range urls {
+		if i > 2 {
+			fmt.Fprintf(&sb, "; and %d more", len(urls)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "; %s: %v", u, e.Errors[u])
+	}
+	return sb.String()
+}
+
+// Unwrap produces every error in the batch, so that errors.Is and errors.As
+// match if any of them do
+func (e *BatchError) Unwrap() []error {
+	urls := e.urls()
+	errs := make([]error, len(urls))
+	for i, u := range urls {
+		errs[i] = e.Errors[u]
+	}
+	return errs
+}
+
+// Concurrently calls fn for each URL, with at most n calls in progress at
+// once; if n is zero or less, DefaultConcurrency is used. Every URL is
+// attempted unless the context ends first. If any calls fail, the result is
+// a *BatchError which describes them.
+func Concurrently(cxt context.Context, n int, urls []string, fn func(context.Context, string) error) error {
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs = make(map[string]error)
+		sem  = make(chan struct{}, n)
+	)
+	fail := func(u string, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		errs[u] = err
+	}
+
+	for _, u := range urls {
+		if err := cxt.Err(); err != nil {
+			fail(u, err)
+			continue
+		}
+		select {
+		case <-cxt.Done():
+			fail(u, cxt.Err())
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(u string) {
+			defer func() { <-sem; wg.Done() }()
+			if err := fn(cxt, u); err != nil {
+				fail(u, err)
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrently(t *testing.T) {
+	cxt := context.Background()
+
+	var urls []string
+	for i := 0; i < 20; i++ {
+		urls = append(urls, fmt.Sprintf("mem://batch/%02d", i))
+	}
+
+	// every URL is attempted, never more than the limit at once
+	var active, peak, count int32
+	err := Concurrently(cxt, 3, urls, func(cxt context.Context, u string) error {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(len(urls)), count)
+	assert.LessOrEqual(t, peak, int32(3))
+
+	// failures are reported by URL
+	err = Concurrently(cxt, 0, urls, func(cxt context.Context, u string) error {
+		if strings.HasSuffix(u, "5") {
+			return ErrNotFound
+		}
+		return nil
+	})
+	var berr *BatchError
+	if assert.True(t, errors.As(err, &berr)) {
+		assert.Len(t, berr.Errors, 2)
+		assert.Contains(t, berr.Errors, "mem://batch/05")
+		assert.Contains(t, berr.Errors, "mem://batch/15")
+	}
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// nothing more is attempted once the context ends
+	cxt, cancel := context.WithCancel(cxt)
+	cancel()
+	count = 0
+	err = Concurrently(cxt, 1, urls, func(cxt context.Context, u string) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, count)
+}
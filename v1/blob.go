@@ -3,13 +3,39 @@ package blob
 import (
 	"context"
 	"io"
+	"time"
 
 	siter "github.com/bww/go-iterator/v1"
 )
 
+// Resource describes a stored object. Fields which a backend cannot
+// determine are left as their zero value.
 type Resource struct {
-	URL         string
-	ContentType string
+	URL                string
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	ContentLanguage    string
+	CacheControl       string
+	Size               int64
+	Created            time.Time
+	Updated            time.Time
+	ETag               string // an opaque version identifier
+	Generation         int64  // a version number, which changes when the resource content changes
+	MD5                []byte
+	CRC32C             uint32
+	Metadata           map[string]string
+	IsPrefix           bool // the resource is a common prefix of other resources, like a directory, and not itself an object
+}
+
+// Writer writes a resource. The resource is only stored once the writer is
+// closed, at which point it is replaced in its entirety. If the writer is
+// aborted instead, or if the context it was created with ends before it is
+// closed, nothing is stored.
+type Writer interface {
+	io.WriteCloser
+	// Abort discards everything written so far, for the specified reason. Once a writer has been aborted, closing it returns ErrAborted; aborting a writer which has already been closed has no effect.
+	Abort(err error) error
 }
 
 type Client interface {
@@ -19,10 +45,16 @@ type Client interface {
 	Read(cxt context.Context, url string, opts ...ReadOption) (io.ReadCloser, error)
 	// List iterates over resources under a prefix URL, producing a description of each one
 	List(cxt context.Context, url string, opts ...ReadOption) (siter.Iterator[Resource], error)
-	// Accessor obtains a URL which provides access to the underlying resource; for example, a signed GCS URL
+	// Stat describes the specified resource without reading its content; if it does not exist, ErrNotFound is returned
+	Stat(cxt context.Context, url string, opts ...ReadOption) (Resource, error)
+	// Accessor obtains a URL which provides access to the underlying resource; for example, a signed GCS URL. Options a backend cannot honor produce ErrNotSupported
 	Accessor(cxt context.Context, url string, opts ...ReadOption) (string, error)
 	// Write obtains a writer which writes to the specified resource; if it does not exist, it is created; if it does exist it is overwritten
-	Write(cxt context.Context, url string, opts ...WriteOption) (io.WriteCloser, error)
+	Write(cxt context.Context, url string, opts ...WriteOption) (Writer, error)
+	// Copy duplicates the source resource at the destination, preserving its attributes unless they are overridden; if the destination exists it is overwritten
+	Copy(cxt context.Context, src, dst string, opts ...WriteOption) error
+	// Move relocates the source resource to the destination, preserving its attributes unless they are overridden; if the destination exists it is overwritten
+	Move(cxt context.Context, src, dst string, opts ...WriteOption) error
 	// Delete permenantly removes the underlying resource
 	Delete(cxt context.Context, url string, opts ...WriteOption) error
 }
@@ -0,0 +1,519 @@
+// Package cache caches resources read from any blob client in a local
+// directory.
+//
+// Resources are cached in their entirety the first time they are read and
+// read from the cache thereafter, until they are evicted to keep the cache
+// within its size or are found to have changed. A cached resource is used
+// without consulting the origin for a configurable period, after which it is
+// revalidated against the origin by its ETag or generation before it is
+// used again. Resources are cached by the URL they are read with, so the
+// same resource read with different URLs is cached more than once.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/fs"
+	siter "github.com/bww/go-iterator/v1"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cached resources are described by metadata which records the resource
+// they were read from and its version at the time
+const (
+	metaURL        = "url"
+	metaETag       = "etag"
+	metaGeneration = "generation"
+)
+
+type Config struct {
+	MaxSize int64         // the maximum total size of cached resources, in bytes; zero or less is unbounded
+	TTL     time.Duration // the period for which a cached resource is used without revalidating it; zero or less always revalidates
+}
+
+// Client reads resources from an origin client through a cache, which is a
+// directory managed by a filesystem client. The directory should be used
+// only by the cache. Every operation other than reading is performed on the
+// origin; writing, moving, or deleting a resource through the client also
+// removes it from the cache, but changes made to the origin by other means
+// are only noticed once a cached resource is revalidated.
+//
+// When the cache is full the least recently used resources are evicted.
+// Resources which are larger than the cache are read directly from the
+// origin. Concurrent reads of a resource which must be fetched or
+// revalidated share a single request to the origin.
+type Client struct {
+	origin  blob.Client
+	cache   *fs.Client
+	maxSize int64
+	ttl     time.Duration
+	group   singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	lru     *list.List // of *entry, the most recently used first
+	size    int64
+	pending map[string]bool // fetches in progress, which are invalidated by setting them to false
+}
+
+// entry describes a cached resource
+type entry struct {
+	url        string
+	file       string
+	etag       string
+	generation int64
+	size       int64
+	validated  time.Time
+	elem       *list.Element
+}
+
+// matches determines whether a resource is the version which was cached
+func (e *entry) matches(res blob.Resource) bool {
+	if e.etag != "" && res.ETag != "" {
+		return e.etag == res.ETag
+	}
+	if e.generation != 0 && res.Generation != 0 {
+		return e.generation == res.Generation
+	}
+	return false // we can't tell, so assume it has changed
+}
+
+func New(origin blob.Client, cache *fs.Client) *Client {
+	return NewWithConfig(origin, cache, Config{})
+}
+
+func NewWithConfig(origin blob.Client, cache *fs.Client, conf Config) *Client {
+	return &Client{
+		origin:  origin,
+		cache:   cache,
+		maxSize: conf.MaxSize,
+		ttl:     conf.TTL,
+		entries: make(map[string]*entry),
+		lru:     list.New(),
+		pending: make(map[string]bool),
+	}
+}
+
+// Init initializes the origin and the cache directory, then indexes the
+// resources a previous client left in the cache so they can be reused.
+// They are revalidated before they are used.
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	err := c.origin.Init(cxt, opts...)
+	if err != nil {
+		return err
+	}
+	err = c.cache.Init(cxt)
+	if err != nil {
+		return err
+	}
+	return c.index(cxt)
+}
+
+// index adds the resources in the cache directory to the cache, the most
+// recently cached first
+func (c *Client) index(cxt context.Context) error {
+	res, err := siter.CollectErr(c.cache.List(cxt, ""))
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(res, func(a, b blob.Resource) int {
+		return b.Updated.Compare(a.Updated)
+	})
+
+	c.mu.Lock()
+	for _, e := range res {
+		u, ok := e.Metadata[metaURL]
+		if !ok || c.entries[u] != nil {
+			continue // not something we cached
+		}
+		gen, _ := strconv.ParseInt(e.Metadata[metaGeneration], 10, 64)
+		v := &entry{
+			url:        u,
+			file:       e.URL,
+			etag:       e.Metadata[metaETag],
+			generation: gen,
+			size:       e.Size,
+		}
+		v.elem = c.lru.PushBack(v)
+		c.entries[u] = v
+		c.size += v.size
+	}
+	stale := c.evict()
+	c.mu.Unlock()
+	c.discard(cxt, stale)
+	return nil
+}
+
+// key produces a path for a cached copy of a resource. Every copy has a path
+// of its own, so a copy which is discarded after the cache is unlocked can't
+// take a newer one with it.
+func key(rc string) string {
+	sum := sha256.Sum256([]byte(rc))
+	h := hex.EncodeToString(sum[:])
+	return h[:2] + "/" + h + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Read reads a resource from the cache, fetching it from the origin first if
+// it isn't cached or has changed. A resource read with
+// blob.WithReadCompressed is read from the origin.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if conf.Compressed {
+		return c.origin.Read(cxt, rc, opts...)
+	}
+	e, err := c.load(cxt, rc)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil { // not cached
+		return c.origin.Read(cxt, rc, opts...)
+	}
+	r, err := c.cache.Read(cxt, e.file, opts...)
+	if errors.Is(err, blob.ErrNotFound) {
+		c.drop(cxt, e) // evicted since we found it, or removed from under us
+		return c.origin.Read(cxt, rc, opts...)
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load produces the cache entry for a resource, fetching or revalidating it
+// if necessary. A nil entry means the resource can't be cached.
+func (c *Client) load(cxt context.Context, rc string) (*entry, error) {
+	c.mu.Lock()
+	e := c.fresh(rc)
+	c.mu.Unlock()
+	if e != nil {
+		return e, nil
+	}
+	// the fetch is shared, so it continues even if this read is canceled
+	ch := c.group.DoChan(rc, func() (any, error) {
+		return c.fetch(context.WithoutCancel(cxt), rc)
+	})
+	select {
+	case <-cxt.Done():
+		return nil, cxt.Err()
+	case v := <-ch:
+		if v.Err != nil {
+			return nil, v.Err
+		}
+		return v.Val.(*entry), nil
+	}
+}
+
+// fresh produces the entry for a resource if it can be used without being
+// revalidated. The cache must be locked.
+func (c *Client) fresh(rc string) *entry {
+	e, ok := c.entries[rc]
+	if !ok || c.ttl <= 0 || time.Since(e.validated) >= c.ttl {
+		return nil
+	}
+	c.lru.MoveToFront(e.elem)
+	return e
+}
+
+// fetch revalidates a cached resource, or fetches it from the origin if it
+// isn't cached or has changed
+func (c *Client) fetch(cxt context.Context, rc string) (*entry, error) {
+	c.mu.Lock()
+	if e := c.fresh(rc); e != nil {
+		c.mu.Unlock()
+		return e, nil // revalidated by the fetch before this one
+	}
+	cached := c.entries[rc]
+	c.pending[rc] = true
+	c.mu.Unlock()
+
+	res, err := c.origin.Stat(cxt, rc)
+	if err != nil {
+		c.abandon(rc)
+		if errors.Is(err, blob.ErrNotFound) {
+			c.invalidate(cxt, rc)
+		}
+		return nil, err
+	}
+	if cached != nil && cached.matches(res) {
+		return c.revalidated(rc, cached), nil
+	}
+	if c.maxSize > 0 && res.Size > c.maxSize {
+		c.abandon(rc)
+		c.invalidate(cxt, rc)
+		return nil, nil // too large to cache
+	}
+
+	e := &entry{
+		url:        rc,
+		file:       key(rc),
+		etag:       res.ETag,
+		generation: res.Generation,
+	}
+	e.size, err = c.download(cxt, e, res)
+	if err != nil {
+		c.abandon(rc)
+		return nil, err
+	}
+	return c.add(cxt, e), nil
+}
+
+// download copies a resource from the origin to the cache
+func (c *Client) download(cxt context.Context, e *entry, res blob.Resource) (int64, error) {
+	r, err := c.origin.Read(cxt, e.url)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, err := c.cache.Write(cxt, e.file,
+		blob.WithContentType(res.ContentType),
+		blob.WithMetadata(map[string]string{
+			metaURL:        e.url,
+			metaETag:       e.etag,
+			metaGeneration: strconv.FormatInt(e.generation, 10),
+		}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		w.Abort(err)
+		return 0, err
+	}
+	return n, w.Close()
+}
+
+// done records that the fetch of a resource is complete, producing whether
+// it is still valid. The cache must be locked.
+func (c *Client) done(rc string) bool {
+	valid := c.pending[rc]
+	delete(c.pending, rc)
+	return valid
+}
+
+// abandon records that the fetch of a resource failed
+func (c *Client) abandon(rc string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done(rc)
+}
+
+// revalidated records that a cached resource has not changed. The entry is
+// produced unless it was invalidated or evicted in the meantime.
+func (c *Client) revalidated(rc string, e *entry) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done(rc) || c.entries[rc] != e {
+		return nil
+	}
+	e.validated = time.Now()
+	c.lru.MoveToFront(e.elem)
+	return e
+}
+
+// add adds a fetched resource to the cache, replacing any previous version
+// of it. The entry is produced unless it was invalidated while it was being
+// fetched, or was evicted at once to make room.
+func (c *Client) add(cxt context.Context, e *entry) *entry {
+	c.mu.Lock()
+	if !c.done(e.url) {
+		c.mu.Unlock()
+		c.discard(cxt, []string{e.file}) // the resource changed while it was fetched
+		return nil
+	}
+	var stale []string
+	if old, ok := c.entries[e.url]; ok {
+		stale = append(stale, c.remove(old))
+	}
+	e.validated = time.Now()
+	e.elem = c.lru.PushFront(e)
+	c.entries[e.url] = e
+	c.size += e.size
+	stale = append(stale, c.evict()...)
+	cached := c.entries[e.url] == e
+	c.mu.Unlock()
+	c.discard(cxt, stale)
+	if !cached {
+		return nil
+	}
+	return e
+}
+
+// evict removes the least recently used resources until the cache is within
+// its size, producing their files. The cache must be locked.
+func (c *Client) evict() []string {
+	var stale []string
+	for c.maxSize > 0 && c.size > c.maxSize {
+		stale = append(stale, c.remove(c.lru.Back().Value.(*entry)))
+	}
+	return stale
+}
+
+// remove removes an entry from the cache, producing its file, which the
+// caller discards once the cache is unlocked. The cache must be locked.
+func (c *Client) remove(e *entry) string {
+	if c.entries[e.url] == e {
+		delete(c.entries, e.url)
+		c.lru.Remove(e.elem)
+		c.size -= e.size
+	}
+	return e.file
+}
+
+// discard deletes the files of entries which have been removed from the
+// cache. The cache must not be locked.
+func (c *Client) discard(cxt context.Context, files []string) {
+	for _, e := range files {
+		c.cache.Delete(cxt, e) // there's nothing to be done if this fails
+	}
+}
+
+// drop removes an entry, if it is still cached
+func (c *Client) drop(cxt context.Context, e *entry) {
+	c.mu.Lock()
+	if c.entries[e.url] != e {
+		c.mu.Unlock()
+		return
+	}
+	f := c.remove(e)
+	c.mu.Unlock()
+	c.discard(cxt, []string{f})
+}
+
+// invalidate removes a resource from the cache, including any version of it
+// which is being fetched
+func (c *Client) invalidate(cxt context.Context, rc string) {
+	c.invalidateMany(cxt, []string{rc})
+}
+
+// invalidateMany removes resources from the cache, including any versions of
+// them which are being fetched
+func (c *Client) invalidateMany(cxt context.Context, urls []string) {
+	var stale []string
+	c.mu.Lock()
+	for _, rc := range urls {
+		if _, ok := c.pending[rc]; ok {
+			c.pending[rc] = false
+		}
+		if e, ok := c.entries[rc]; ok {
+			stale = append(stale, c.remove(e))
+		}
+	}
+	c.mu.Unlock()
+	c.discard(cxt, stale)
+}
+
+// invalidatePrefix removes every resource under a prefix from the cache
+func (c *Client) invalidatePrefix(cxt context.Context, prefix string) {
+	var stale []string
+	c.mu.Lock()
+	for rc := range c.pending {
+		if strings.HasPrefix(rc, prefix) {
+			c.pending[rc] = false
+		}
+	}
+	for rc, e := range c.entries {
+		if strings.HasPrefix(rc, prefix) {
+			stale = append(stale, c.remove(e))
+		}
+	}
+	c.mu.Unlock()
+	c.discard(cxt, stale)
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	return c.origin.List(cxt, rc, opts...)
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (blob.Resource, error) {
+	return c.origin.Stat(cxt, rc, opts...)
+}
+
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
+	return c.origin.Accessor(cxt, rc, opts...)
+}
+
+// Write writes a resource to the origin, removing it from the cache both
+// when the write begins and when it ends
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	c.invalidate(cxt, rc)
+	w, err := c.origin.Write(cxt, rc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{Writer: w, cxt: cxt, rc: rc, cache: c}, nil
+}
+
+// writer invalidates the resource it writes once it has been written
+type writer struct {
+	blob.Writer
+	cxt   context.Context
+	rc    string
+	cache *Client
+}
+
+func (w *writer) Close() error {
+	defer w.cache.invalidate(w.cxt, w.rc)
+	return w.Writer.Close()
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	defer c.invalidate(cxt, dst)
+	return c.origin.Copy(cxt, src, dst, opts...)
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	defer func() {
+		c.invalidate(cxt, src)
+		c.invalidate(cxt, dst)
+	}()
+	return c.origin.Move(cxt, src, dst, opts...)
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	defer c.invalidate(cxt, rc)
+	return c.origin.Delete(cxt, rc, opts...)
+}
+
+// DeleteMany deletes resources from the origin and removes them from the
+// cache, even if some of them couldn't be deleted
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	defer c.invalidateMany(cxt, urls)
+	return blob.DeleteMany(cxt, c.origin, urls, opts...)
+}
+
+// DeletePrefix deletes every resource under a prefix from the origin and
+// removes every cached resource under it, including any the origin no longer
+// had
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	defer c.invalidatePrefix(cxt, prefix)
+	return blob.DeletePrefix(cxt, c.origin, prefix, opts...)
+}
+
+// Purge removes every resource from the cache
+func (c *Client) Purge(cxt context.Context) error {
+	c.invalidatePrefix(cxt, "")
+	return c.cache.DeletePrefix(cxt, "")
+}
+
+func (c *Client) String() string {
+	return fmt.Sprintf("%v (cached in %v)", c.origin, c.cache)
+}
+
+// wrap describes an error produced while reading through the cache, such as
+// a failure to fetch a resource into it
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, nil, *err)
+}
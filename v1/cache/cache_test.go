@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/fs"
+	"github.com/bww/go-blob/v1/impl/mem"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// counter counts the resources read from the client it wraps; reads are
+// slow, so that concurrent reads overlap
+type counter struct {
+	blob.Client
+	reads atomic.Int64
+}
+
+func (c *counter) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+	c.reads.Add(1)
+	time.Sleep(time.Millisecond * 50)
+	return c.Client.Read(cxt, rc, opts...)
+}
+
+func TestCache(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	origin := &counter{Client: backend}
+	dir := t.TempDir()
+	local, err := fs.New(cxt, "file://"+dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	store := NewWithConfig(origin, local, Config{MaxSize: 64, TTL: time.Hour})
+	assert.NoError(t, store.Init(cxt))
+
+	read := func(c blob.Client, dsn string, opts ...blob.ReadOption) (string, error) {
+		r, err := c.Read(cxt, dsn, opts...)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		return string(d), err
+	}
+	write := func(c blob.Client, dsn, data string, opts ...blob.WriteOption) error {
+		w, err := c.Write(cxt, dsn, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(data))
+		if err != nil {
+			w.Abort(err)
+			return err
+		}
+		return w.Close()
+	}
+	cached := func() int {
+		res, err := siter.CollectErr(local.List(cxt, ""))
+		assert.NoError(t, err)
+		return len(res)
+	}
+
+	d1, d2 := "This is the first version", "This is the second version"
+
+	// a resource is fetched once, however many readers want it at once
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	assert.NoError(t, write(store, dsn, d1))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := read(store, dsn)
+			if assert.NoError(t, err) {
+				assert.Equal(t, d1, d)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), origin.reads.Load())
+	assert.Equal(t, 1, cached())
+
+	// then read from the cache, including ranges
+	fmt.Printf("<= %s\n", dsn)
+	d, err := read(store, dsn, blob.WithRange(8, 9))
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1[8:17], d)
+	}
+	assert.Equal(t, int64(1), origin.reads.Load())
+
+	// a change made to the origin directly isn't noticed until the resource
+	// is revalidated, which a client with no TTL always does
+	fmt.Printf("=> %s (origin)\n", dsn)
+	assert.NoError(t, write(backend, dsn, d2))
+	d, err = read(store, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1, d)
+	}
+	other, err := fs.New(cxt, "file://"+t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+	revalidating := New(origin, other)
+	d, err = read(revalidating, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d2, d)
+	}
+	assert.Equal(t, int64(2), origin.reads.Load())
+	d, err = read(revalidating, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d2, d)
+	}
+	assert.Equal(t, int64(2), origin.reads.Load(), "an unchanged resource should not be fetched again")
+
+	// a change made through the client is noticed at once
+	fmt.Printf("=> %s\n", dsn)
+	assert.NoError(t, write(store, dsn, d1))
+	d, err = read(store, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1, d)
+	}
+
+	// the least recently used resources are evicted to stay within the
+	// maximum size, and resources larger than that aren't cached at all
+	for _, e := range []string{"file2", "file3"} {
+		fmt.Printf("=> %s\n", e)
+		assert.NoError(t, write(store, e, d2))
+		_, err = read(store, e)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, cached())
+	dsn = "large"
+	assert.NoError(t, write(store, dsn, d1+d2+d1))
+	d, err = read(store, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1+d2+d1, d)
+	}
+	assert.Equal(t, 2, cached())
+
+	// another client indexes what's already cached, which it revalidates
+	// rather than fetches
+	fmt.Printf("<= %s (reindexed)\n", "file3")
+	reads := origin.reads.Load()
+	reindexed := NewWithConfig(origin, local, Config{MaxSize: 64, TTL: time.Hour})
+	assert.NoError(t, reindexed.Init(cxt))
+	d, err = read(reindexed, "file3")
+	if assert.NoError(t, err) {
+		assert.Equal(t, d2, d)
+	}
+	assert.Equal(t, reads, origin.reads.Load())
+
+	// deleting a resource removes it from the cache
+	dsn = "file3"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.NoError(t, store.Delete(cxt, dsn))
+	_, err = read(store, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	assert.Equal(t, 1, cached())
+
+	// clean up
+	err = blob.DeletePrefix(cxt, store, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cached())
+	assert.NoError(t, store.Purge(cxt))
+}
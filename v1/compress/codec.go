@@ -0,0 +1,64 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses and decompresses content in a particular encoding
+type Codec interface {
+	// Encoding is the content encoding the codec produces, e.g., "gzip"
+	Encoding() string
+	// NewWriter creates a writer which compresses the data written to it to w
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader creates a reader which decompresses the data read from r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip compresses content with gzip
+type Gzip struct {
+	Level int // the compression level, from gzip.BestSpeed to gzip.BestCompression; zero uses the default
+}
+
+func (c Gzip) Encoding() string {
+	return "gzip"
+}
+
+func (c Gzip) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (c Gzip) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Zstd compresses content with Zstandard
+type Zstd struct {
+	Level int // the compression level, from 1 to 22 as zstd defines them; zero uses the default
+}
+
+func (c Zstd) Encoding() string {
+	return "zstd"
+}
+
+func (c Zstd) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := zstd.SpeedDefault
+	if c.Level != 0 {
+		level = zstd.EncoderLevelFromZstd(c.Level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+}
+
+func (c Zstd) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
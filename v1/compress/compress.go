@@ -0,0 +1,355 @@
+// Package compress compresses resources before they are written to any blob
+// client, and decompresses them as they are read back.
+//
+// A compressed resource is stored with the content encoding of its codec and
+// with the encoding recorded in its metadata under EncodingKey, which is how
+// it is recognized when it is read; resources without it are read as they
+// are, so compressed and uncompressed resources can be mixed freely. Content
+// of a type which is already compressed is not compressed again. Resources
+// are described as they are stored, so their sizes and checksums are those
+// of the compressed content.
+package compress
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// EncodingKey is the metadata key under which the encoding of a compressed
+// resource is recorded
+const EncodingKey = "blob-encoding"
+
+// compressed is the set of content types, other than images, audio, and
+// video, whose content is already compressed
+var compressed = map[string]struct{}{
+	"application/gzip":             {},
+	"application/x-gzip":           {},
+	"application/zstd":             {},
+	"application/zip":              {},
+	"application/x-bzip2":          {},
+	"application/x-xz":             {},
+	"application/x-7z-compressed":  {},
+	"application/vnd.rar":          {},
+	"application/x-rar-compressed": {},
+	"font/woff":                    {},
+	"font/woff2":                   {},
+}
+
+// IsCompressed determines whether content of a type is already compressed,
+// in which case compressing it again would gain little
+func IsCompressed(contentType string) bool {
+	t, _, _ := strings.Cut(contentType, ";")
+	t = strings.ToLower(strings.TrimSpace(t))
+	if _, ok := compressed[t]; ok {
+		return true
+	}
+	switch major, minor, _ := strings.Cut(t, "/"); major {
+	case "image":
+		return minor != "svg+xml" && minor != "bmp"
+	case "audio", "video":
+		return true
+	default:
+		return false
+	}
+}
+
+type Config struct {
+	Codec Codec                         // the codec with which content is compressed; nil uses Gzip
+	Skip  func(contentType string) bool // determines whether content of a type is left uncompressed; nil uses IsCompressed
+}
+
+// Client compresses the resources it writes to the client it wraps and
+// decompresses those it reads from it. Resources are read with whichever
+// codec they were written with, provided it is the configured codec or one
+// of the codecs this package provides.
+type Client struct {
+	client blob.Client
+	codec  Codec
+	codecs map[string]Codec
+	skip   func(string) bool
+}
+
+func New(client blob.Client) *Client {
+	return NewWithConfig(client, Config{})
+}
+
+func NewWithConfig(client blob.Client, conf Config) *Client {
+	codec := conf.Codec
+	if codec == nil {
+		codec = Gzip{}
+	}
+	skip := conf.Skip
+	if skip == nil {
+		skip = IsCompressed
+	}
+	codecs := make(map[string]Codec)
+	for _, e := range []Codec{Gzip{}, Zstd{}, codec} {
+		codecs[e.Encoding()] = e
+	}
+	return &Client{
+		client: client,
+		codec:  codec,
+		codecs: codecs,
+		skip:   skip,
+	}
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return c.client.Init(cxt, opts...)
+}
+
+// Read decompresses a resource if it was compressed. Compressed content
+// can't be read from the middle, so a range is read by decompressing the
+// content which precedes it and discarding it; a range relative to the end
+// of the resource retains that many bytes while it decompresses the whole
+// resource. A resource read with blob.WithReadCompressed is not
+// decompressed.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if conf.Compressed {
+		return c.client.Read(cxt, rc, opts...)
+	}
+	res, err := c.client.Stat(cxt, rc)
+	if err != nil {
+		return nil, err
+	}
+	enc, ok := res.Metadata[EncodingKey]
+	if !ok {
+		return c.client.Read(cxt, rc, opts...)
+	}
+	codec, ok := c.codecs[enc]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown encoding %q", blob.ErrNotSupported, enc)
+	}
+
+	r, err := c.client.Read(cxt, rc, blob.WithReadCompressed())
+	if err != nil {
+		return nil, err
+	}
+	d, err := codec.NewReader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	src, err := seek(d, conf.Offset, conf.Length)
+	if err != nil {
+		d.Close()
+		r.Close()
+		return nil, err
+	}
+	return &reader{Reader: src, d: d, r: r}, nil
+}
+
+// seek discards decompressed content up to an offset and limits what
+// follows it to length bytes, or none if length is zero or less
+func seek(r io.Reader, offset, length int64) (io.Reader, error) {
+	if offset > 0 {
+		_, err := io.CopyN(io.Discard, r, offset)
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: offset exceeds size", blob.ErrInvalidRange)
+		} else if err != nil {
+			return nil, err
+		}
+	} else if offset < 0 {
+		d, err := tail(r, -offset)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(d)
+	}
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+	return r, nil
+}
+
+// tail reads to the end of a stream, retaining only its last n bytes
+func tail(r io.Reader, n int64) ([]byte, error) {
+	var buf []byte
+	chunk := make([]byte, 32<<10)
+	for {
+		c, err := r.Read(chunk)
+		buf = append(buf, chunk[:c]...)
+		if int64(len(buf)) > 2*n {
+			buf = append(buf[:0], buf[int64(len(buf))-n:]...)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(buf)) > n {
+		buf = buf[int64(len(buf))-n:]
+	}
+	return buf, nil
+}
+
+// reader reads decompressed content and closes both the decompressor and
+// the underlying reader
+type reader struct {
+	io.Reader
+	d io.Closer
+	r io.Closer
+}
+
+func (r *reader) Close() error {
+	r.d.Close()
+	return r.r.Close()
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	return c.client.List(cxt, rc, opts...)
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (blob.Resource, error) {
+	return c.client.Stat(cxt, rc, opts...)
+}
+
+// Accessor produces an accessor for the resource as it is stored. Since a
+// compressed resource is served with its content encoding, most HTTP clients
+// decompress it on their own.
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
+	return c.client.Accessor(cxt, rc, opts...)
+}
+
+// Write compresses a resource as it is written, unless its content is
+// already compressed or already has a content encoding. Content of an
+// unspecified type is assumed to be of the type its extension implies.
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	ctype := conf.ContentType
+	if ctype == "" {
+		ctype = mime.TypeByExtension(path.Ext(rc))
+	}
+	if conf.ContentEncoding != "" || c.skip(ctype) {
+		return c.client.Write(cxt, rc, opts...)
+	}
+
+	enc := c.codec.Encoding()
+	md := maps.Clone(conf.Metadata)
+	if md == nil {
+		md = make(map[string]string)
+	}
+	md[EncodingKey] = enc
+	w, err := c.client.Write(cxt, rc, append(opts, blob.WithContentEncoding(enc), blob.WithMetadata(md))...)
+	if err != nil {
+		return nil, err
+	}
+	z, err := c.codec.NewWriter(w)
+	if err != nil {
+		w.Abort(err)
+		return nil, err
+	}
+	return &writer{Writer: w, z: z}, nil
+}
+
+// writer compresses the data written to it
+type writer struct {
+	blob.Writer
+	z       io.WriteCloser
+	aborted bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.aborted {
+		return 0, blob.ErrAborted
+	}
+	return w.z.Write(p)
+}
+
+func (w *writer) Abort(err error) error {
+	w.aborted = true
+	return w.Writer.Abort(err)
+}
+
+// Close flushes the compressed content and completes the resource
+func (w *writer) Close() error {
+	if w.aborted {
+		return w.Writer.Close()
+	}
+	err := w.z.Close()
+	if err != nil {
+		w.Writer.Abort(err)
+		return err
+	}
+	return w.Writer.Close()
+}
+
+// Copy copies a resource as it is stored. If the copy's metadata is
+// replaced, the encoding of a compressed resource is carried over to it.
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	opts, err = c.preserve(cxt, src, opts)
+	if err != nil {
+		return err
+	}
+	return c.client.Copy(cxt, src, dst, opts...)
+}
+
+// Move moves a resource as it is stored. If the moved resource's metadata
+// is replaced, the encoding of a compressed resource is carried over to it.
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	opts, err = c.preserve(cxt, src, opts)
+	if err != nil {
+		return err
+	}
+	return c.client.Move(cxt, src, dst, opts...)
+}
+
+// preserve adds the encoding of a compressed resource to metadata which
+// replaces its own, without which its copy would be read as it is stored
+func (c *Client) preserve(cxt context.Context, src string, opts []blob.WriteOption) ([]blob.WriteOption, error) {
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	if conf.Metadata == nil {
+		return opts, nil
+	}
+	if _, ok := conf.Metadata[EncodingKey]; ok {
+		return opts, nil
+	}
+	res, err := c.client.Stat(cxt, src)
+	if err != nil {
+		return nil, err
+	}
+	enc, ok := res.Metadata[EncodingKey]
+	if !ok {
+		return opts, nil
+	}
+	md := maps.Clone(conf.Metadata)
+	md[EncodingKey] = enc
+	return append(opts, blob.WithMetadata(md)), nil
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	return c.client.Delete(cxt, rc, opts...)
+}
+
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	return blob.DeleteMany(cxt, c.client, urls, opts...)
+}
+
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+}
+
+func (c *Client) String() string {
+	return fmt.Sprint(c.client)
+}
+
+// wrap describes a codec's failure to compress or decompress a resource,
+// leaving errors the underlying client has described as they are
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, nil, *err)
+}
@@ -0,0 +1,173 @@
+package compress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://compress")
+	if !assert.NoError(t, err) {
+		return
+	}
+	gz, zst := New(backend), NewWithConfig(backend, Config{Codec: Zstd{Level: 3}})
+
+	read := func(c blob.Client, dsn string, opts ...blob.ReadOption) (string, error) {
+		r, err := c.Read(cxt, dsn, opts...)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		return string(d), err
+	}
+	write := func(c blob.Client, dsn, data string, opts ...blob.WriteOption) error {
+		w, err := c.Write(cxt, dsn, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(data))
+		if err != nil {
+			w.Abort(err)
+			return err
+		}
+		return w.Close()
+	}
+
+	d1 := strings.Repeat(`{"id":1,"name":"This line repeats, so it compresses well"}`+"\n", 100)
+
+	// write a resource with each codec; both are stored compressed, with their
+	// encodings, and both can be read by either client
+	for _, c := range []*Client{gz, zst} {
+		enc := c.codec.Encoding()
+		dsn = "file." + enc
+		fmt.Printf("=> %s\n", dsn)
+		if !assert.NoError(t, write(c, dsn, d1, blob.WithContentType("application/x-ndjson"), blob.WithMetadata(map[string]string{"a": "b"}))) {
+			continue
+		}
+		res, err := backend.Stat(cxt, dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/x-ndjson", res.ContentType)
+			assert.Equal(t, enc, res.ContentEncoding)
+			assert.Equal(t, map[string]string{"a": "b", EncodingKey: enc}, res.Metadata)
+			assert.Less(t, res.Size, int64(len(d1)))
+		}
+		raw, err := read(backend, dsn)
+		if assert.NoError(t, err) {
+			assert.NotContains(t, raw, "repeats")
+		}
+		d, err := read(c, dsn, blob.WithReadCompressed())
+		if assert.NoError(t, err) {
+			assert.Equal(t, raw, d)
+		}
+		for _, e := range []*Client{gz, zst} {
+			fmt.Printf("<= %s (%s)\n", dsn, e.codec.Encoding())
+			d, err := read(e, dsn)
+			if assert.NoError(t, err) {
+				assert.Equal(t, d1, d)
+			}
+		}
+	}
+
+	// read ranges, which must be found by decompressing what precedes them
+	dsn = "file.gzip"
+	for _, e := range []struct{ offset, length int64 }{
+		{0, 5}, {7, 4}, {100, 200}, {17, 0}, {-5, 0}, {-200, 4}, {-100000, 10}, {int64(len(d1)), 0},
+	} {
+		fmt.Printf("<= %s [%d, %d]\n", dsn, e.offset, e.length)
+		d, err := read(gz, dsn, blob.WithRange(e.offset, e.length))
+		if !assert.NoError(t, err, "%v", e) {
+			continue
+		}
+		start := max(e.offset, -int64(len(d1)))
+		if start < 0 {
+			start += int64(len(d1))
+		}
+		end := int64(len(d1))
+		if e.length > 0 {
+			end = start + e.length
+		}
+		assert.Equal(t, d1[start:end], d, "%v", e)
+	}
+	_, err = read(gz, dsn, blob.WithOffset(int64(len(d1))+1))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// resources which weren't compressed are read as they are, as are those
+	// whose content is already compressed or encoded, which aren't compressed
+	dsn = "plain"
+	fmt.Printf("=> %s\n", dsn)
+	assert.NoError(t, write(backend, dsn, d1))
+	d, err := read(gz, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1[7:11], d)
+	}
+	for _, e := range []struct {
+		dsn  string
+		opts []blob.WriteOption
+	}{
+		{"image", []blob.WriteOption{blob.WithContentType("image/png")}},
+		{"archive.zip", nil},
+		{"encoded", []blob.WriteOption{blob.WithContentEncoding("br")}},
+	} {
+		fmt.Printf("=> %s\n", e.dsn)
+		if assert.NoError(t, write(gz, e.dsn, d1, e.opts...)) {
+			raw, err := read(backend, e.dsn)
+			if assert.NoError(t, err) {
+				assert.Equal(t, d1, raw)
+			}
+			d, err := read(gz, e.dsn)
+			if assert.NoError(t, err) {
+				assert.Equal(t, d1, d)
+			}
+		}
+	}
+
+	// a resource with an encoding we don't know can't be read
+	dsn = "unknown"
+	assert.NoError(t, write(backend, dsn, d1, blob.WithMetadata(map[string]string{EncodingKey: "lzw"})))
+	_, err = read(gz, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
+	// an aborted write stores nothing
+	dsn = "aborted"
+	w, err := gz.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+		_, err = gz.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	// copies remain readable, even when their metadata is replaced
+	fmt.Printf("=> %s\n", "copy1")
+	err = gz.Copy(cxt, "file.zstd", "copy1", blob.WithMetadata(map[string]string{"c": "d"}))
+	if assert.NoError(t, err) {
+		res, err := backend.Stat(cxt, "copy1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, map[string]string{"c": "d", EncodingKey: "zstd"}, res.Metadata)
+		}
+		d, err := read(gz, "copy1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, d1, d)
+		}
+	}
+
+	// clean up
+	err = blob.DeletePrefix(cxt, gz, "")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,301 @@
+// Package crypt encrypts resources before they are written to any blob
+// client, and decrypts them as they are read back.
+//
+// Every resource is encrypted with its own data key, which is wrapped by a
+// KeyProvider and stored in a header at the beginning of the resource. The
+// content follows in chunks, each of which is sealed with AES-256-GCM, so a
+// resource is encrypted and decrypted as it is streamed and is never
+// buffered in its entirety. Resources are described as they are stored, so
+// their sizes and checksums are those of the encrypted content.
+package crypt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// DefaultChunkSize is the size of the plaintext chunks in which content is
+// encrypted if no chunk size is specified
+const DefaultChunkSize = 64 << 10
+
+var (
+	ErrNotEncrypted   = errors.New("Not encrypted")
+	ErrAuthentication = errors.New("Message authentication failed")
+	ErrUnknownKey     = errors.New("Unknown key")
+	ErrInvalidKey     = errors.New("Invalid key")
+	ErrTooLarge       = errors.New("Too large")
+)
+
+type Config struct {
+	ChunkSize int // the size of the plaintext chunks in which content is encrypted; zero uses DefaultChunkSize
+}
+
+// Client encrypts the resources it writes to the client it wraps and
+// decrypts those it reads from it. Every other operation is performed on
+// the stored resources as they are: copies and moves preserve encrypted
+// content, which remains readable since its key travels with it.
+type Client struct {
+	client    blob.Client
+	keys      KeyProvider
+	chunkSize int
+}
+
+func New(client blob.Client, keys KeyProvider) *Client {
+	return NewWithConfig(client, keys, Config{})
+}
+
+func NewWithConfig(client blob.Client, keys KeyProvider, conf Config) *Client {
+	size := conf.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	return &Client{
+		client:    client,
+		keys:      keys,
+		chunkSize: min(size, maxChunkSize),
+	}
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return c.client.Init(cxt, opts...)
+}
+
+// Read decrypts a resource. A range is read by decrypting only the chunks
+// it spans; a range relative to the end of the resource must first
+// describe it, in order to determine its size.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if conf.Offset == 0 {
+		r, err := c.client.Read(cxt, rc)
+		if err != nil {
+			return nil, err
+		}
+		src := bufio.NewReader(r)
+		d, err := c.reader(cxt, r, src, 0, 0, conf.Length)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return d, nil
+	}
+
+	h, err := c.header(cxt, rc)
+	if err != nil {
+		return nil, err
+	}
+	offset := conf.Offset
+	if offset < 0 {
+		res, err := c.client.Stat(cxt, rc)
+		if err != nil {
+			return nil, err
+		}
+		offset = max(h.plainSize(res.Size)+offset, 0)
+	}
+
+	// a range begins in the chunk which contains the byte before it, so that
+	// a range which begins at the end of the resource begins in the last
+	// chunk, which is the only one that can tell us so
+	var index int64
+	if offset > 0 {
+		index = (offset - 1) / int64(h.chunkSize)
+	}
+	r, err := c.client.Read(cxt, rc, blob.WithOffset(h.size()+index*int64(h.chunkSize+overhead)))
+	if err != nil {
+		return nil, err
+	}
+	src := bufio.NewReader(r)
+	d, err := c.decrypt(cxt, r, src, h, index, offset-index*int64(h.chunkSize), conf.Length)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// header reads the header of a resource
+func (c *Client) header(cxt context.Context, rc string) (header, error) {
+	r, err := c.client.Read(cxt, rc, blob.WithRange(0, maxHeaderSize))
+	if err != nil {
+		return header{}, err
+	}
+	defer r.Close()
+	return readHeader(bufio.NewReader(r))
+}
+
+// reader reads the header of a resource from its stream, then decrypts the
+// content which follows it
+func (c *Client) reader(cxt context.Context, r io.ReadCloser, src *bufio.Reader, index, skip, length int64) (*reader, error) {
+	h, err := readHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	return c.decrypt(cxt, r, src, h, index, skip, length)
+}
+
+// decrypt unwraps the data key of a resource and decrypts its content from
+// the indexed chunk onwards
+func (c *Client) decrypt(cxt context.Context, r io.ReadCloser, src *bufio.Reader, h header, index, skip, length int64) (*reader, error) {
+	key, err := c.keys.UnwrapKey(cxt, h.keyId, h.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key: %v", ErrInvalidKey, err)
+	}
+	return newReader(r, src, aead, h, uint64(index), skip, length)
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	return c.client.List(cxt, rc, opts...)
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (blob.Resource, error) {
+	return c.client.Stat(cxt, rc, opts...)
+}
+
+// Accessor is not supported, since whoever used the URL it produced would
+// obtain the encrypted resource
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
+	return "", blob.NewError(blob.OpAccessor, rc, nil, fmt.Errorf("%w: encrypted resources can't be accessed directly", blob.ErrNotSupported))
+}
+
+// Write encrypts a resource with a new data key as it is written
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	key := make([]byte, keySize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	h, err := newHeader(c.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	h.keyId, h.wrapped, err = c.wrapKey(cxt, key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := c.client.Write(cxt, rc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(h.encode())
+	if err != nil {
+		w.Abort(err)
+		return nil, err
+	}
+	return newWriter(w, aead, h), nil
+}
+
+// wrapKey wraps a data key, checking that the result can be stored
+func (c *Client) wrapKey(cxt context.Context, key []byte) (string, []byte, error) {
+	id, wrapped, err := c.keys.WrapKey(cxt, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(id) > maxKeyIdSize {
+		return "", nil, fmt.Errorf("%w: key ID %q is too long", ErrInvalidKey, id)
+	}
+	if len(wrapped) > maxWrapSize {
+		return "", nil, fmt.Errorf("%w: wrapped key is too long", ErrInvalidKey)
+	}
+	return id, wrapped, nil
+}
+
+// Rewrap rewraps the data key of a resource with the current key of the key
+// provider, which is how key encryption keys are rotated. The resource is
+// rewritten with its new header, but its content is not re-encrypted. If
+// the data key is already wrapped by the current key, or if the resource
+// changes while it is being rewrapped, nothing is written; in the latter
+// case the result is blob.ErrPreconditionFailed.
+func (c *Client) Rewrap(cxt context.Context, rc string) (err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	res, err := c.client.Stat(cxt, rc)
+	if err != nil {
+		return err
+	}
+	r, err := c.client.Read(cxt, rc)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	src := bufio.NewReader(r)
+	h, err := readHeader(src)
+	if err != nil {
+		return err
+	}
+	key, err := c.keys.UnwrapKey(cxt, h.keyId, h.wrapped)
+	if err != nil {
+		return err
+	}
+	id, wrapped, err := c.wrapKey(cxt, key)
+	if err != nil {
+		return err
+	} else if id == h.keyId {
+		return nil // already wrapped by the current key
+	}
+	h.keyId, h.wrapped = id, wrapped
+
+	w, err := c.client.Write(cxt, rc,
+		blob.WithContentType(res.ContentType),
+		blob.WithContentEncoding(res.ContentEncoding),
+		blob.WithContentDisposition(res.ContentDisposition),
+		blob.WithContentLanguage(res.ContentLanguage),
+		blob.WithCacheControl(res.CacheControl),
+		blob.WithMetadata(res.Metadata),
+		blob.WithIfMatch(res.ETag),
+	)
+	if err != nil {
+		return err
+	}
+	err = rewrite(w, h, src)
+	if err != nil {
+		w.Abort(err)
+		return err
+	}
+	return w.Close()
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.client.Copy(cxt, src, dst, opts...)
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.client.Move(cxt, src, dst, opts...)
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	return c.client.Delete(cxt, rc, opts...)
+}
+
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	return blob.DeleteMany(cxt, c.client, urls, opts...)
+}
+
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+}
+
+func (c *Client) String() string {
+	return fmt.Sprint(c.client)
+}
+
+// wrap describes an error produced while encrypting or decrypting a
+// resource; errors from the underlying client are already described
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, nil, *err)
+}
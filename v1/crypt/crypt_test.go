@@ -0,0 +1,234 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrypt(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	k1, k2 := make([]byte, 32), make([]byte, 32)
+	rand.Read(k1)
+	rand.Read(k2)
+	ring1, err := NewKeyring("k1", map[string][]byte{"k1": k1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = NewKeyring("k1", map[string][]byte{"k1": k1[:16]})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	backend, err := mem.New(cxt, "mem://crypt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	store := NewWithConfig(backend, ring1, Config{ChunkSize: 16})
+
+	read := func(c blob.Client, dsn string, opts ...blob.ReadOption) (string, error) {
+		r, err := c.Read(cxt, dsn, opts...)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		return string(d), err
+	}
+	write := func(c blob.Client, dsn, data string, opts ...blob.WriteOption) error {
+		w, err := c.Write(cxt, dsn, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(data))
+		if err != nil {
+			w.Abort(err)
+			return err
+		}
+		return w.Close()
+	}
+
+	d1 := `Hello, this is the data, which spans several chunks.`
+
+	// write a resource, in pieces which don't align with chunks
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn, blob.WithContentType("text/plain"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, e := range []string{d1[:5], d1[5:30], d1[30:]} {
+		_, err = w.Write([]byte(e))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	// it's stored encrypted, with its attributes
+	raw, err := read(backend, dsn)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, raw, "Hello")
+		assert.True(t, strings.HasPrefix(raw, magic))
+	}
+	res, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/plain", res.ContentType)
+		assert.Equal(t, int64(len(raw)), res.Size)
+	}
+
+	// and it's decrypted when it's read
+	fmt.Printf("<= %s\n", dsn)
+	d, err := read(store, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1, d)
+	}
+
+	// read ranges, which begin and end within and on the edges of chunks
+	for _, e := range []struct{ offset, length int64 }{
+		{0, 5}, {7, 4}, {15, 2}, {16, 16}, {17, 0}, {32, 0}, {-5, 0}, {-20, 4}, {int64(len(d1)), 0},
+	} {
+		fmt.Printf("<= %s [%d, %d]\n", dsn, e.offset, e.length)
+		d, err := read(store, dsn, blob.WithRange(e.offset, e.length))
+		if !assert.NoError(t, err, "%v", e) {
+			continue
+		}
+		start := e.offset
+		if start < 0 {
+			start += int64(len(d1))
+		}
+		end := int64(len(d1))
+		if e.length > 0 {
+			end = start + e.length
+		}
+		assert.Equal(t, d1[start:end], d, "%v", e)
+	}
+	_, err = read(store, dsn, blob.WithOffset(int64(len(d1))+1))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+	_, err = read(store, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// content which fills its last chunk exactly, and no content at all
+	for _, e := range []string{d1[:32], ""} {
+		dsn = fmt.Sprintf("exact%d", len(e))
+		fmt.Printf("=> %s\n", dsn)
+		if assert.NoError(t, write(store, dsn, e)) {
+			d, err := read(store, dsn)
+			if assert.NoError(t, err) {
+				assert.Equal(t, e, d)
+			}
+			d, err = read(store, dsn, blob.WithOffset(int64(len(e))))
+			if assert.NoError(t, err) {
+				assert.Equal(t, "", d)
+			}
+		}
+	}
+
+	// tampering with the content is detected, as is truncating it, even at a
+	// chunk boundary
+	dsn = "file1"
+	h, err := readHeader(strings.NewReader(raw))
+	if assert.NoError(t, err) {
+		body := int(h.size())
+		flipped := []byte(raw)
+		flipped[body+20] ^= 1
+		for name, e := range map[string][]byte{
+			"flipped":   flipped,
+			"truncated": []byte(raw[:body+2*(16+overhead)]),
+			"reordered": append([]byte(raw[:body]), append([]byte(raw[body+16+overhead:body+2*(16+overhead)]), raw[body:body+16+overhead]...)...),
+		} {
+			fmt.Printf("=> %s (%s)\n", dsn, name)
+			assert.NoError(t, write(backend, "tampered", string(e)))
+			_, err = read(store, "tampered")
+			assert.ErrorIs(t, err, ErrAuthentication, name)
+		}
+	}
+	_, err = read(store, "tampered", blob.WithOffset(3))
+	assert.ErrorIs(t, err, ErrAuthentication)
+
+	// resources which aren't encrypted can't be read
+	assert.NoError(t, write(backend, "plain", d1))
+	_, err = read(store, "plain")
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	// an aborted write stores nothing
+	dsn = "aborted"
+	w, err = store.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	// copies remain readable, since their key travels with them
+	err = store.Copy(cxt, "file1", "copy1")
+	if assert.NoError(t, err) {
+		d, err := read(store, "copy1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, d1, d)
+		}
+	}
+
+	// accessors would expose the encrypted content
+	_, err = store.Accessor(cxt, "file1")
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
+	// rotate keys: a keyring without the old key can't read the resource
+	// until it's been rewrapped by a keyring with both
+	ring2, err := NewKeyring("k2", map[string][]byte{"k1": k1, "k2": k2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ring3, err := NewKeyring("k2", map[string][]byte{"k2": k2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	rotated, retired := New(backend, ring2), New(backend, ring3)
+	dsn = "file1"
+	_, err = read(retired, dsn)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	fmt.Printf("=> %s (rewrap)\n", dsn)
+	before, err := read(backend, dsn)
+	assert.NoError(t, err)
+	assert.NoError(t, rotated.Rewrap(cxt, dsn))
+	after, err := read(backend, dsn)
+	if assert.NoError(t, err) {
+		ha, err := readHeader(strings.NewReader(after))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "k2", ha.keyId)
+			assert.Equal(t, before[h.size():], after[ha.size():], "content should not be re-encrypted")
+		}
+	}
+	d, err = read(retired, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1, d)
+	}
+	res, err = backend.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/plain", res.ContentType)
+	}
+
+	// rewrapping again does nothing
+	assert.NoError(t, rotated.Rewrap(cxt, dsn))
+	again, err := read(backend, dsn)
+	if assert.NoError(t, err) {
+		assert.True(t, bytes.Equal([]byte(after), []byte(again)))
+	}
+
+	// clean up
+	err = blob.DeletePrefix(cxt, store, "")
+	assert.NoError(t, err)
+}
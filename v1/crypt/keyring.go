@@ -0,0 +1,92 @@
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// KeyProvider wraps and unwraps the data keys with which resources are
+// encrypted. A data key is never stored unless it has been wrapped.
+type KeyProvider interface {
+	// WrapKey encrypts a data key with the current key encryption key, producing the ID of that key and the wrapped data key
+	WrapKey(cxt context.Context, key []byte) (string, []byte, error)
+	// UnwrapKey decrypts a data key which was wrapped by the identified key encryption key
+	UnwrapKey(cxt context.Context, id string, wrapped []byte) ([]byte, error)
+}
+
+// Keyring is a KeyProvider which holds its key encryption keys in memory.
+// Data keys are wrapped with AES-256-GCM by the primary key. The other keys
+// are retained so that data keys wrapped by them can still be unwrapped,
+// which is how keys are rotated: a new primary key is added and resources
+// are rewrapped by it, after which the old key can be retired.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from a set of 256-bit keys by ID. Data keys
+// are wrapped by the primary key, which must be one of them.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: no primary key %q", ErrUnknownKey, primary)
+	}
+	ring := &Keyring{
+		primary: primary,
+		keys:    make(map[string]cipher.AEAD),
+	}
+	for id, key := range keys {
+		if len(id) > maxKeyIdSize {
+			return nil, fmt.Errorf("%w: key ID %q is too long", ErrInvalidKey, id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidKey, id, err)
+		}
+		ring.keys[id] = aead
+	}
+	return ring, nil
+}
+
+// WrapKey wraps a data key with the primary key. The wrapped key is
+// authenticated along with the ID of the key which wrapped it.
+func (k *Keyring) WrapKey(cxt context.Context, key []byte) (string, []byte, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(key)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.primary, aead.Seal(nonce, nonce, key, []byte(k.primary)), nil
+}
+
+// UnwrapKey unwraps a data key with the identified key
+func (k *Keyring) UnwrapKey(cxt context.Context, id string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, ErrAuthentication
+	}
+	key, err := aead.Open(nil, wrapped[:n], wrapped[n:], []byte(id))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return key, nil
+}
+
+// newAEAD creates an AES-GCM cipher with a 256-bit key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("expected a %d-byte key, got %d bytes", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,352 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bww/go-blob/v1"
+)
+
+// An encrypted resource consists of a header followed by a sequence of
+// chunks. The header is:
+//
+//	magic       4 bytes  "BLBE"
+//	version     1 byte
+//	chunk size  4 bytes  the size of a plaintext chunk, big-endian
+//	nonce       4 bytes  a random prefix for the nonce of every chunk
+//	key ID      1 byte length, followed by the ID of the key which wrapped the data key
+//	wrapped key 2 bytes length, big-endian, followed by the wrapped data key
+//
+// Each chunk is a chunk of plaintext sealed with AES-256-GCM under the data
+// key. Every chunk but the last contains a full chunk of plaintext. The
+// nonce of a chunk is the nonce prefix, followed by the index of the chunk
+// in 7 bytes, big-endian, followed by 1 if it is the last chunk or 0 if it
+// is not, so chunks can be neither reordered nor dropped without detection.
+// The fixed part of the header is authenticated with every chunk; the key
+// ID and wrapped key are not, so they can be replaced when the data key is
+// rewrapped without re-encrypting the content.
+const (
+	magic         = "BLBE"
+	version       = 1
+	prefixSize    = 4 + 1 + 4 + 4 // the fixed part of the header
+	keySize       = 32
+	nonceSize     = 12
+	overhead      = 16 // the size of a GCM tag
+	maxKeyIdSize  = 255
+	maxWrapSize   = 1024
+	maxHeaderSize = prefixSize + 1 + maxKeyIdSize + 2 + maxWrapSize
+	maxChunkSize  = 16 << 20
+	maxChunks     = 1 << 56
+)
+
+type header struct {
+	chunkSize int
+	nonce     [4]byte
+	keyId     string
+	wrapped   []byte
+}
+
+// prefix produces the fixed part of the header, which is authenticated
+// with every chunk
+func (h header) prefix() []byte {
+	b := make([]byte, 0, prefixSize)
+	b = append(b, magic...)
+	b = append(b, version)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.chunkSize))
+	return append(b, h.nonce[:]...)
+}
+
+// encode produces the encoded header
+func (h header) encode() []byte {
+	b := h.prefix()
+	b = append(b, byte(len(h.keyId)))
+	b = append(b, h.keyId...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(h.wrapped)))
+	return append(b, h.wrapped...)
+}
+
+// size is the length of the encoded header
+func (h header) size() int64 {
+	return int64(prefixSize + 1 + len(h.keyId) + 2 + len(h.wrapped))
+}
+
+// plainSize produces the size of the plaintext of an encrypted resource of
+// the specified size
+func (h header) plainSize(size int64) int64 {
+	body := size - h.size()
+	n := (body + int64(h.chunkSize+overhead) - 1) / int64(h.chunkSize+overhead)
+	return max(body-n*overhead, 0)
+}
+
+// readHeader reads the header of an encrypted resource
+func readHeader(r io.Reader) (header, error) {
+	var h header
+	b := make([]byte, prefixSize+1)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return h, notEncrypted(err)
+	}
+	if string(b[:4]) != magic {
+		return h, fmt.Errorf("%w: unrecognized header", ErrNotEncrypted)
+	}
+	if b[4] != version {
+		return h, fmt.Errorf("%w: unsupported version %d", ErrNotEncrypted, b[4])
+	}
+	h.chunkSize = int(binary.BigEndian.Uint32(b[5:9]))
+	if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+		return h, fmt.Errorf("%w: invalid chunk size %d", ErrNotEncrypted, h.chunkSize)
+	}
+	copy(h.nonce[:], b[9:13])
+
+	id := make([]byte, int(b[13]))
+	_, err = io.ReadFull(r, id)
+	if err != nil {
+		return h, notEncrypted(err)
+	}
+	h.keyId = string(id)
+
+	var n uint16
+	err = binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return h, notEncrypted(err)
+	}
+	if n > maxWrapSize {
+		return h, fmt.Errorf("%w: wrapped key is too long", ErrNotEncrypted)
+	}
+	h.wrapped = make([]byte, n)
+	_, err = io.ReadFull(r, h.wrapped)
+	if err != nil {
+		return h, notEncrypted(err)
+	}
+	return h, nil
+}
+
+func notEncrypted(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated header", ErrNotEncrypted)
+	}
+	return err
+}
+
+// newHeader creates a header with a random nonce prefix
+func newHeader(chunkSize int) (header, error) {
+	h := header{chunkSize: chunkSize}
+	_, err := rand.Read(h.nonce[:])
+	return h, err
+}
+
+// sealer produces the nonces for a stream of chunks
+type sealer struct {
+	aead  cipher.AEAD
+	ad    []byte
+	nonce [nonceSize]byte
+}
+
+func newSealer(aead cipher.AEAD, h header) *sealer {
+	s := &sealer{aead: aead, ad: h.prefix()}
+	copy(s.nonce[:4], h.nonce[:])
+	return s
+}
+
+// next produces the nonce of the indexed chunk
+func (s *sealer) next(index uint64, last bool) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], index)
+	copy(s.nonce[4:11], b[1:])
+	if last {
+		s.nonce[11] = 1
+	} else {
+		s.nonce[11] = 0
+	}
+	return s.nonce[:]
+}
+
+// writer encrypts the data written to it a chunk at a time. A full chunk is
+// only sealed once more data follows it, since until then it may turn out
+// to be the last one.
+type writer struct {
+	blob.Writer
+	seal  *sealer
+	buf   []byte
+	out   []byte
+	index uint64
+	err   error
+}
+
+func newWriter(w blob.Writer, aead cipher.AEAD, h header) *writer {
+	return &writer{
+		Writer: w,
+		seal:   newSealer(aead, h),
+		buf:    make([]byte, 0, h.chunkSize),
+		out:    make([]byte, 0, h.chunkSize+overhead),
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var n int
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			w.err = w.flush(false)
+			if w.err != nil {
+				return n, w.err
+			}
+		}
+		c := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// flush seals the buffered chunk and writes it
+func (w *writer) flush(last bool) error {
+	if w.index >= maxChunks {
+		return fmt.Errorf("%w: too many chunks", ErrTooLarge)
+	}
+	w.out = w.seal.aead.Seal(w.out[:0], w.seal.next(w.index, last), w.buf, w.seal.ad)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.Writer.Write(w.out)
+	return err
+}
+
+func (w *writer) Abort(err error) error {
+	if w.err == nil {
+		w.err = blob.ErrAborted
+	}
+	return w.Writer.Abort(err)
+}
+
+// Close seals the last chunk and completes the resource
+func (w *writer) Close() error {
+	if w.err == nil {
+		w.err = w.flush(true)
+	}
+	if errors.Is(w.err, blob.ErrAborted) {
+		return w.Writer.Close()
+	} else if w.err != nil {
+		w.Writer.Abort(w.err)
+		return w.err
+	}
+	return w.Writer.Close()
+}
+
+// reader decrypts a stream of chunks, beginning at a chunk boundary
+type reader struct {
+	r      io.ReadCloser
+	src    *bufio.Reader
+	open   *sealer
+	size   int
+	index  uint64
+	buf    []byte
+	plain  []byte
+	remain int64 // the number of bytes remaining to be read, or -1 for all of them
+	last   bool
+	err    error
+}
+
+// newReader creates a reader which decrypts chunks from the indexed chunk
+// onwards. The first skip bytes of plaintext are discarded and at most
+// length bytes follow, or all of them if length is zero or less. The first
+// chunk is decrypted immediately, so that a resource which cannot be
+// decrypted, or a range which begins beyond the end of the resource, is
+// reported at once.
+func newReader(r io.ReadCloser, src *bufio.Reader, aead cipher.AEAD, h header, index uint64, skip, length int64) (*reader, error) {
+	d := &reader{
+		r:      r,
+		src:    src,
+		open:   newSealer(aead, h),
+		size:   h.chunkSize,
+		index:  index,
+		buf:    make([]byte, h.chunkSize+overhead),
+		remain: -1,
+	}
+	if length > 0 {
+		d.remain = length
+	}
+	err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	if skip > int64(len(d.plain)) {
+		if d.last {
+			return nil, fmt.Errorf("%w: offset exceeds size", blob.ErrInvalidRange)
+		}
+		return nil, ErrAuthentication // only the last chunk may be short
+	}
+	d.plain = d.plain[skip:]
+	return d, nil
+}
+
+// next decrypts the next chunk
+func (d *reader) next() error {
+	n, err := io.ReadFull(d.src, d.buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		d.last = true // a short chunk is the last one
+	} else if err != nil {
+		return err
+	} else if _, err := d.src.Peek(1); err == io.EOF {
+		d.last = true // a full chunk is the last one if nothing follows it
+	} else if err != nil {
+		return err
+	}
+	if n < overhead {
+		return ErrAuthentication
+	}
+	d.plain, err = d.open.aead.Open(d.buf[:0], d.open.next(d.index, d.last), d.buf[:n], d.open.ad)
+	if err != nil {
+		return ErrAuthentication
+	}
+	if !d.last && len(d.plain) != d.size {
+		return ErrAuthentication
+	}
+	d.index++
+	return nil
+}
+
+func (d *reader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	for len(d.plain) == 0 {
+		if d.last || d.remain == 0 {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+		if d.err != nil {
+			return 0, d.err
+		}
+	}
+	if d.remain >= 0 && int64(len(p)) > d.remain {
+		p = p[:d.remain]
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	if d.remain >= 0 {
+		d.remain -= int64(n)
+		if d.remain == 0 {
+			d.plain = nil
+		}
+	}
+	return n, nil
+}
+
+func (d *reader) Close() error {
+	return d.r.Close()
+}
+
+// rewrite writes an encrypted resource with a new header
+func rewrite(w io.Writer, h header, body io.Reader) error {
+	_, err := io.Copy(w, io.MultiReader(bytes.NewReader(h.encode()), body))
+	return err
+}
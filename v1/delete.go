@@ -0,0 +1,60 @@
+package blob
+
+import (
+	"context"
+	"errors"
+
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// BulkDeleter is implemented by clients which can delete many resources
+// more efficiently than one at a time
+type BulkDeleter interface {
+	DeleteMany(cxt context.Context, urls []string, opts ...WriteOption) error
+}
+
+// PrefixDeleter is implemented by clients which can delete every resource
+// under a prefix more efficiently than by listing and deleting them
+type PrefixDeleter interface {
+	DeletePrefix(cxt context.Context, prefix string, opts ...WriteOption) error
+}
+
+// DeleteMany deletes every specified resource, using the client's own bulk
+// delete if it has one, and otherwise deleting them concurrently. Resources
+// which do not exist are ignored. If any deletes fail, the result is a
+// *BatchError which describes them.
+func DeleteMany(cxt context.Context, c Client, urls []string, opts ...WriteOption) error {
+	if d, ok := c.(BulkDeleter); ok {
+		return d.DeleteMany(cxt, urls, opts...)
+	}
+	conf := WriteConfig{}.WithOptions(opts)
+	return Concurrently(cxt, conf.Concurrency, urls, func(cxt context.Context, u string) error {
+		err := c.Delete(cxt, u)
+		if errors.Is(err, ErrNotFound) {
+			return nil // already gone
+		}
+		return err
+	})
+}
+
+// DeletePrefix deletes every resource under a prefix, using the client's
+// own prefix delete if it has one, and otherwise listing the resources and
+// deleting them with DeleteMany.
+func DeletePrefix(cxt context.Context, c Client, prefix string, opts ...WriteOption) error {
+	if d, ok := c.(PrefixDeleter); ok {
+		return d.DeletePrefix(cxt, prefix, opts...)
+	}
+	res, err := siter.CollectErr(c.List(cxt, prefix))
+	if errors.Is(err, ErrNotFound) {
+		return nil // nothing to delete
+	} else if err != nil {
+		return err
+	}
+	urls := make([]string, 0, len(res))
+	for _, e := range res {
+		if !e.IsPrefix {
+			urls = append(urls, e.URL)
+		}
+	}
+	return DeleteMany(cxt, c, urls, opts...)
+}
@@ -1,9 +1,134 @@
 package blob
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+)
 
 var (
 	ErrNotFound     = errors.New("Not found")
 	ErrInvalidURL   = errors.New("Invalid URL")
 	ErrNotSupported = errors.New("Not supported")
+	ErrInvalidRange = errors.New("Invalid range")
+	ErrInvalidToken = errors.New("Invalid page token")
+	ErrAborted      = errors.New("Aborted")
+
+	ErrPermission         = errors.New("Permission denied")
+	ErrAlreadyExists      = errors.New("Already exists")
+	ErrPreconditionFailed = errors.New("Precondition failed")
+	ErrUnavailable        = errors.New("Unavailable")
+	ErrCanceled           = errors.New("Canceled")
+)
+
+// kinds are the sentinels which classify errors, in order of precedence
+var kinds = []error{
+	ErrNotFound,
+	ErrInvalidURL,
+	ErrNotSupported,
+	ErrInvalidRange,
+	ErrInvalidToken,
+	ErrAborted,
+	ErrPermission,
+	ErrAlreadyExists,
+	ErrPreconditionFailed,
+	ErrUnavailable,
+	ErrCanceled,
+}
+
+// Op identifies the operation which produced an error
+type Op string
+
+const (
+	OpInit         = Op("init")
+	OpRead         = Op("read")
+	OpList         = Op("list")
+	OpStat         = Op("stat")
+	OpAccessor     = Op("accessor")
+	OpWrite        = Op("write")
+	OpCopy         = Op("copy")
+	OpMove         = Op("move")
+	OpDelete       = Op("delete")
+	OpDeleteMany   = Op("delete many")
+	OpDeletePrefix = Op("delete prefix")
 )
+
+// Error describes a failed operation on a resource. Its kind is one of the
+// sentinel errors in this package, if the cause could be classified, and
+// its cause is the error produced by the backend. Both are matched by
+// errors.Is and errors.As, so a caller can check for ErrNotFound while still
+// having access to, say, the underlying *googleapi.Error.
+type Error struct {
+	Op   Op
+	URL  string
+	Kind error // the sentinel which classifies the error, if any
+	Err  error // the underlying cause
+}
+
+func (e *Error) Error() string {
+	var cause error
+	switch {
+	case e.Err == nil:
+		cause = e.Kind
+	case e.Kind == nil, errors.Is(e.Err, e.Kind):
+		cause = e.Err
+	default:
+		cause = fmt.Errorf("%v: %v", e.Kind, e.Err)
+	}
+	if e.URL == "" {
+		return fmt.Sprintf("%s: %v", e.Op, cause)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.URL, cause)
+}
+
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// NewError describes an error produced by an operation on a resource. If
+// kind is nil, it is inferred from the cause. If the cause is nil, the
+// result is nil; if it is already an *Error, it is returned as it is.
+func NewError(op Op, url string, kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if kind == nil {
+		kind = Kind(err)
+	}
+	return &Error{Op: op, URL: url, Kind: kind, Err: err}
+}
+
+// Kind classifies an error as one of the sentinel errors in this package. In
+// addition to the sentinels themselves, context and filesystem errors are
+// recognized. If the error cannot be classified, the result is nil.
+func Kind(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrCanceled
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	case errors.Is(err, fs.ErrExist):
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
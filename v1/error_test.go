@@ -0,0 +1,55 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	cause := &fs.PathError{Op: "remove", Path: "/tmp/file1", Err: fs.ErrNotExist}
+
+	// errors are classified from their cause, which is retained
+	err := NewError(OpDelete, "file:///tmp/file1", nil, cause)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	var perr *fs.PathError
+	assert.ErrorAs(t, err, &perr)
+	assert.Equal(t, "delete file:///tmp/file1: Not found: remove /tmp/file1: file does not exist", err.Error())
+
+	// an explicit kind takes precedence
+	err = NewError(OpRead, "gcs://a/b/c", ErrUnavailable, errors.New("googleapi: Error 503"))
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, "read gcs://a/b/c: Unavailable: googleapi: Error 503", err.Error())
+
+	// sentinels are not repeated
+	err = NewError(OpStat, "mem://a/b", nil, fmt.Errorf("%w: offset 10", ErrInvalidRange))
+	assert.Equal(t, "stat mem://a/b: Invalid range: offset 10", err.Error())
+
+	// errors are only described once, by the innermost operation
+	err = NewError(OpCopy, "mem://a/b", nil, NewError(OpWrite, "mem://a/c", nil, ErrPreconditionFailed))
+	var berr *Error
+	if assert.ErrorAs(t, err, &berr) {
+		assert.Equal(t, OpWrite, berr.Op)
+		assert.Equal(t, ErrPreconditionFailed, berr.Kind)
+	}
+
+	// nothing is described as nothing
+	assert.Nil(t, NewError(OpRead, "mem://a/b", nil, nil))
+
+	for e, k := range map[error]error{
+		context.Canceled:                   ErrCanceled,
+		context.DeadlineExceeded:           ErrCanceled,
+		os.ErrPermission:                   ErrPermission,
+		os.ErrExist:                        ErrAlreadyExists,
+		fmt.Errorf("%w: x", ErrNotFound):   ErrNotFound,
+		errors.New("something unexpected"): nil,
+	} {
+		assert.Equal(t, k, Kind(e), "%v", e)
+	}
+}
@@ -0,0 +1,413 @@
+// Package httpblob exposes a blob.Client over HTTP.
+//
+// Resources are addressed by their key, relative to the path at which the
+// handler is mounted. The following requests are supported:
+//
+//	GET    /<key>            read a resource, honoring Range, If-None-Match and If-Modified-Since
+//	HEAD   /<key>            describe a resource
+//	PUT    /<key>            write a resource, honoring If-Match and If-None-Match: *
+//	DELETE /<key>            delete a resource, honoring If-Match
+//	GET    /<prefix>?list    list resources under a prefix, as JSON or NDJSON
+//
+// Resource attributes are carried in the standard HTTP headers, and
+// user-defined metadata in headers prefixed with X-Blob-Meta-. Since header
+// names are case-insensitive, metadata names are always lower case.
+package httpblob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bww/go-blob/v1"
+)
+
+const (
+	// MetaPrefix is the prefix of headers which carry user-defined metadata
+	MetaPrefix = "X-Blob-Meta-"
+	// NextPageTokenHeader carries the token for the next page of a listing
+	NextPageTokenHeader = "X-Blob-Next-Page-Token"
+	// ContentTypeNDJSON is the media type of a newline-delimited JSON listing
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+var (
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrForbidden    = errors.New("Forbidden")
+)
+
+// Authorizer decides whether a request for the resource with the specified
+// key may proceed. If it returns an error the request is refused: with 401
+// Unauthorized if the error is ErrUnauthorized, and otherwise with 403
+// Forbidden.
+type Authorizer func(req *http.Request, key string) error
+
+type Config struct {
+	// Prefix is the path at which the handler is mounted; it is removed from
+	// request paths to obtain resource keys
+	Prefix string
+	// Root is the URL of the root of the client's namespace. Resource URLs
+	// which begin with it are made relative to it in listings. Relative URLs
+	// are always used as they are. If empty, the client's own URL is used.
+	Root string
+	// Authorize, if provided, is consulted before every request is served
+	Authorize Authorizer
+}
+
+// Handler serves the resources managed by a blob.Client
+type Handler struct {
+	client    blob.Client
+	prefix    string
+	root      string
+	authorize Authorizer
+}
+
+func New(client blob.Client) *Handler {
+	return NewWithConfig(client, Config{})
+}
+
+func NewWithConfig(client blob.Client, conf Config) *Handler {
+	root := conf.Root
+	if root == "" {
+		root = strings.TrimSuffix(fmt.Sprint(client), "/") + "/"
+	}
+	return &Handler{
+		client:    client,
+		prefix:    "/" + strings.Trim(conf.Prefix, "/"),
+		root:      root,
+		authorize: conf.Authorize,
+	}
+}
+
+// key produces the resource key for a request path, if the path is under
+// the handler's prefix
+func (h *Handler) key(p string) (string, bool) {
+	if !strings.HasPrefix(p, h.prefix) {
+		return "", false
+	}
+	p = p[len(h.prefix):]
+	if p != "" && p[0] != '/' && h.prefix != "/" {
+		return "", false // a sibling of the prefix, not under it
+	}
+	return strings.TrimPrefix(p, "/"), true
+}
+
+func (h *Handler) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	key, ok := h.key(req.URL.Path)
+	if !ok {
+		http.NotFound(rsp, req)
+		return
+	}
+	if h.authorize != nil {
+		if err := h.authorize(req, key); errors.Is(err, ErrUnauthorized) {
+			http.Error(rsp, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(rsp, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	_, list := req.URL.Query()["list"]
+	switch {
+	case list && req.Method == http.MethodGet:
+		h.list(rsp, req, key)
+	case key == "":
+		http.NotFound(rsp, req)
+	case req.Method == http.MethodGet, req.Method == http.MethodHead:
+		h.read(rsp, req, key)
+	case req.Method == http.MethodPut:
+		h.write(rsp, req, key)
+	case req.Method == http.MethodDelete:
+		h.delete(rsp, req, key)
+	default:
+		rsp.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) read(rsp http.ResponseWriter, req *http.Request, key string) {
+	res, err := h.client.Stat(req.Context(), key)
+	if err != nil {
+		handleError(rsp, err)
+		return
+	}
+
+	hdr := rsp.Header()
+	setHeaders(hdr, res)
+	hdr.Set("Accept-Ranges", "bytes")
+	if notModified(req, res) {
+		rsp.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	status := http.StatusOK
+	start, length := int64(0), res.Size
+	if v := req.Header.Get("Range"); v != "" {
+		var ok bool
+		start, length, ok = parseRange(v, res.Size)
+		if !ok {
+			hdr.Set("Content-Range", fmt.Sprintf("bytes */%d", res.Size))
+			http.Error(rsp, blob.ErrInvalidRange.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if length < res.Size {
+			status = http.StatusPartialContent
+			hdr.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, res.Size))
+		}
+	}
+	hdr.Set("Content-Length", strconv.FormatInt(length, 10))
+	if req.Method == http.MethodHead {
+		rsp.WriteHeader(status)
+		return
+	}
+
+	// the content is served as it is stored, along with its content encoding
+	opts := []blob.ReadOption{blob.WithReadCompressed()}
+	if status == http.StatusPartialContent {
+		opts = append(opts, blob.WithRange(start, length))
+	}
+	r, err := h.client.Read(req.Context(), key, opts...)
+	if err != nil {
+		hdr.Del("Content-Length")
+		hdr.Del("Content-Range")
+		handleError(rsp, err)
+		return
+	}
+	defer r.Close()
+	rsp.WriteHeader(status)
+	io.Copy(rsp, r)
+}
+
+func (h *Handler) write(rsp http.ResponseWriter, req *http.Request, key string) {
+	opts := writeOptions(req.Header)
+	if v := req.Header.Get("If-Match"); v != "" {
+		opts = append(opts, blob.WithIfMatch(unquote(v)))
+	}
+	if v := req.Header.Get("If-None-Match"); v == "*" {
+		opts = append(opts, blob.WithIfNotExists())
+	} else if v != "" {
+		http.Error(rsp, "Only If-None-Match: * is supported", http.StatusNotImplemented)
+		return
+	}
+
+	w, err := h.client.Write(req.Context(), key, opts...)
+	if err != nil {
+		handleError(rsp, err)
+		return
+	}
+	body := &body{Reader: req.Body}
+	_, err = io.Copy(w, body)
+	if err != nil {
+		// the upload is incomplete, so it must not be stored
+		w.Abort(err)
+		if body.err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+		} else {
+			handleError(rsp, err)
+		}
+		return
+	}
+	err = w.Close()
+	if err != nil {
+		handleError(rsp, err)
+		return
+	}
+
+	if res, err := h.client.Stat(req.Context(), key); err == nil && res.ETag != "" {
+		rsp.Header().Set("ETag", strconv.Quote(res.ETag))
+	}
+	rsp.WriteHeader(http.StatusCreated)
+}
+
+// body records the error produced by reading a request body, so that it can
+// be told apart from an error produced by the writer it is copied to
+type body struct {
+	io.Reader
+	err error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (h *Handler) delete(rsp http.ResponseWriter, req *http.Request, key string) {
+	var opts []blob.WriteOption
+	if v := req.Header.Get("If-Match"); v != "" {
+		opts = append(opts, blob.WithIfMatch(unquote(v)))
+	}
+	err := h.client.Delete(req.Context(), key, opts...)
+	if err != nil {
+		handleError(rsp, err)
+		return
+	}
+	rsp.WriteHeader(http.StatusNoContent)
+}
+
+// notModified determines whether a conditional request can be answered with
+// 304 Not Modified. If-None-Match takes precedence over If-Modified-Since.
+func notModified(req *http.Request, res blob.Resource) bool {
+	if v := req.Header.Get("If-None-Match"); v != "" {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.TrimSpace(e)
+			if e == "*" || (res.ETag != "" && unquote(strings.TrimPrefix(e, "W/")) == res.ETag) {
+				return true
+			}
+		}
+		return false
+	}
+	if v := req.Header.Get("If-Modified-Since"); v != "" && !res.Updated.IsZero() {
+		t, err := http.ParseTime(v)
+		if err == nil && !res.Updated.Truncate(1e9).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange interprets a single byte range against a resource of the
+// specified size. Multiple ranges are not supported, in which case the entire
+// resource is produced, which is permitted by RFC 9110.
+func parseRange(v string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(v, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+	if first == "" { // suffix range; the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+// setHeaders describes a resource in response headers
+func setHeaders(hdr http.Header, res blob.Resource) {
+	if v := res.ContentType; v != "" {
+		hdr.Set("Content-Type", v)
+	} else {
+		hdr.Set("Content-Type", "application/octet-stream")
+	}
+	if v := res.ContentEncoding; v != "" {
+		hdr.Set("Content-Encoding", v)
+	}
+	if v := res.ContentDisposition; v != "" {
+		hdr.Set("Content-Disposition", v)
+	}
+	if v := res.ContentLanguage; v != "" {
+		hdr.Set("Content-Language", v)
+	}
+	if v := res.CacheControl; v != "" {
+		hdr.Set("Cache-Control", v)
+	}
+	if v := res.ETag; v != "" {
+		hdr.Set("ETag", strconv.Quote(v))
+	}
+	if v := res.Updated; !v.IsZero() {
+		hdr.Set("Last-Modified", v.UTC().Format(http.TimeFormat))
+	}
+	for k, v := range res.Metadata {
+		hdr.Set(MetaPrefix+k, v)
+	}
+}
+
+// writeOptions obtains the attributes of a resource being written from
+// request headers
+func writeOptions(hdr http.Header) []blob.WriteOption {
+	var opts []blob.WriteOption
+	if v := hdr.Get("Content-Type"); v != "" {
+		opts = append(opts, blob.WithContentType(v))
+	}
+	if v := hdr.Get("Content-Encoding"); v != "" {
+		opts = append(opts, blob.WithContentEncoding(v))
+	}
+	if v := hdr.Get("Content-Disposition"); v != "" {
+		opts = append(opts, blob.WithContentDisposition(v))
+	}
+	if v := hdr.Get("Content-Language"); v != "" {
+		opts = append(opts, blob.WithContentLanguage(v))
+	}
+	if v := hdr.Get("Cache-Control"); v != "" {
+		opts = append(opts, blob.WithCacheControl(v))
+	}
+	if m := Metadata(hdr); m != nil {
+		opts = append(opts, blob.WithMetadata(m))
+	}
+	return opts
+}
+
+// Metadata obtains user-defined metadata from the X-Blob-Meta- headers in a
+// set of headers. If there are none, the result is nil.
+func Metadata(hdr http.Header) map[string]string {
+	var m map[string]string
+	for k, v := range hdr {
+		if len(v) > 0 && len(k) > len(MetaPrefix) && strings.EqualFold(k[:len(MetaPrefix)], MetaPrefix) {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[strings.ToLower(k[len(MetaPrefix):])] = v[0]
+		}
+	}
+	return m
+}
+
+func unquote(v string) string {
+	if u, err := strconv.Unquote(v); err == nil {
+		return u
+	}
+	return v
+}
+
+// Status produces the HTTP status which corresponds to an error
+func Status(err error) int {
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, blob.ErrInvalidURL), errors.Is(err, blob.ErrInvalidToken):
+		return http.StatusBadRequest
+	case errors.Is(err, blob.ErrInvalidRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, blob.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, blob.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, blob.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, blob.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, blob.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func handleError(rsp http.ResponseWriter, err error) {
+	http.Error(rsp, err.Error(), Status(err))
+}
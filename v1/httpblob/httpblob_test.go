@@ -0,0 +1,262 @@
+package httpblob
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	client, err := mem.New(cxt, "mem://httpblob")
+	if !assert.NoError(t, err) {
+		return
+	}
+	svc := httptest.NewServer(NewWithConfig(client, Config{
+		Prefix: "/blobs",
+		Authorize: func(req *http.Request, key string) error {
+			switch req.Header.Get("Authorization") {
+			case "":
+				return ErrUnauthorized
+			case "Bearer reader":
+				if req.Method != http.MethodGet && req.Method != http.MethodHead {
+					return ErrForbidden
+				}
+			}
+			return nil
+		},
+	}))
+	defer svc.Close()
+	base := svc.URL + "/blobs/"
+
+	do := func(method, key string, body io.Reader, hdr map[string]string) *http.Response {
+		req, err := http.NewRequestWithContext(cxt, method, base+key, body)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		req.Header.Set("Authorization", "Bearer writer")
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return rsp
+	}
+	read := func(rsp *http.Response) string {
+		defer rsp.Body.Close()
+		d, err := io.ReadAll(rsp.Body)
+		assert.NoError(t, err)
+		return string(d)
+	}
+
+	d1 := `Hello, this is the data.`
+
+	// write a resource with attributes
+	key := "dir/file1.txt"
+	fmt.Printf("=> %s\n", key)
+	rsp := do(http.MethodPut, key, strings.NewReader(d1), map[string]string{
+		"Content-Type":      "text/plain",
+		"Cache-Control":     "no-cache",
+		"X-Blob-Meta-Owner": "tests",
+	})
+	read(rsp)
+	assert.Equal(t, http.StatusCreated, rsp.StatusCode)
+	etag := rsp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// it can only be created once
+	rsp = do(http.MethodPut, key, strings.NewReader(d1), map[string]string{"If-None-Match": "*"})
+	read(rsp)
+	assert.Equal(t, http.StatusPreconditionFailed, rsp.StatusCode)
+
+	// read it back, with its attributes
+	fmt.Printf("<= %s\n", key)
+	rsp = do(http.MethodGet, key, nil, nil)
+	assert.Equal(t, d1, read(rsp))
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "text/plain", rsp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", rsp.Header.Get("Cache-Control"))
+	assert.Equal(t, "tests", rsp.Header.Get("X-Blob-Meta-Owner"))
+	assert.Equal(t, etag, rsp.Header.Get("ETag"))
+	lastmod := rsp.Header.Get("Last-Modified")
+	assert.NotEmpty(t, lastmod)
+
+	// read part of it
+	fmt.Printf("<= %s\n", key)
+	rsp = do(http.MethodGet, key, nil, map[string]string{"Range": "bytes=7-10"})
+	assert.Equal(t, "this", read(rsp))
+	assert.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("bytes 7-10/%d", len(d1)), rsp.Header.Get("Content-Range"))
+
+	// read the end of it
+	rsp = do(http.MethodGet, key, nil, map[string]string{"Range": "bytes=-5"})
+	assert.Equal(t, "data.", read(rsp))
+	assert.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+
+	// read beyond the end of it
+	rsp = do(http.MethodGet, key, nil, map[string]string{"Range": "bytes=1000-"})
+	read(rsp)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rsp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("bytes */%d", len(d1)), rsp.Header.Get("Content-Range"))
+
+	// conditional reads of an unchanged resource
+	rsp = do(http.MethodGet, key, nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, "", read(rsp))
+	assert.Equal(t, http.StatusNotModified, rsp.StatusCode)
+	rsp = do(http.MethodGet, key, nil, map[string]string{"If-Modified-Since": lastmod})
+	read(rsp)
+	assert.Equal(t, http.StatusNotModified, rsp.StatusCode)
+	rsp = do(http.MethodGet, key, nil, map[string]string{"If-None-Match": `"not-the-version"`})
+	assert.Equal(t, d1, read(rsp))
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	// describe it
+	rsp = do(http.MethodHead, key, nil, nil)
+	assert.Equal(t, "", read(rsp))
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, int64(len(d1)), rsp.ContentLength)
+
+	// write another resource
+	rsp = do(http.MethodPut, "file2", strings.NewReader(d1), nil)
+	read(rsp)
+	assert.Equal(t, http.StatusCreated, rsp.StatusCode)
+
+	// list everything
+	rsp = do(http.MethodGet, "?list", nil, nil)
+	var list Listing
+	assert.NoError(t, json.Unmarshal([]byte(read(rsp)), &list))
+	if assert.Len(t, list.Entries, 2) {
+		assert.Equal(t, "dir/file1.txt", list.Entries[0].Key)
+		assert.Equal(t, map[string]string{"owner": "tests"}, list.Entries[0].Metadata)
+		assert.Equal(t, "file2", list.Entries[1].Key)
+	}
+
+	// a handler with no configuration lists keys relative to the client too
+	plain := httptest.NewServer(New(client))
+	defer plain.Close()
+	if rsp, err := http.Get(plain.URL + "/?list"); assert.NoError(t, err) {
+		list = Listing{}
+		assert.NoError(t, json.Unmarshal([]byte(read(rsp)), &list))
+		if assert.Len(t, list.Entries, 2) {
+			assert.Equal(t, "dir/file1.txt", list.Entries[0].Key)
+			assert.Equal(t, "file2", list.Entries[1].Key)
+		}
+	}
+
+	// list only the immediate children
+	rsp = do(http.MethodGet, "?list&delimiter=/", nil, nil)
+	list = Listing{}
+	assert.NoError(t, json.Unmarshal([]byte(read(rsp)), &list))
+	if assert.Len(t, list.Entries, 2) {
+		assert.Equal(t, "dir/", list.Entries[0].Key)
+		assert.True(t, list.Entries[0].IsPrefix)
+	}
+
+	// list a page at a time, as NDJSON
+	var keys []string
+	for token := ""; ; {
+		rsp = do(http.MethodGet, "?list&page_size=1&page_token="+token, nil, map[string]string{"Accept": ContentTypeNDJSON})
+		assert.Equal(t, ContentTypeNDJSON, rsp.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(rsp.Body)
+		for scanner.Scan() {
+			var e Entry
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+			fmt.Printf("<... %v\n", e.Key)
+			keys = append(keys, e.Key)
+		}
+		read(rsp)
+		if token = rsp.Trailer.Get(NextPageTokenHeader); token == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"dir/file1.txt", "file2"}, keys)
+
+	// readers can read but can't delete; anonymous requests can't do anything
+	for hdr, status := range map[string]int{"Bearer reader": http.StatusForbidden, "": http.StatusUnauthorized} {
+		req, err := http.NewRequestWithContext(cxt, http.MethodDelete, base+key, nil)
+		if assert.NoError(t, err) {
+			req.Header.Set("Authorization", hdr)
+			rsp, err := http.DefaultClient.Do(req)
+			if assert.NoError(t, err) {
+				read(rsp)
+				assert.Equal(t, status, rsp.StatusCode)
+			}
+		}
+	}
+
+	// a stale version can't be used to delete it, but the current one can
+	fmt.Printf("~~ %s\n", key)
+	rsp = do(http.MethodDelete, key, nil, map[string]string{"If-Match": `"not-the-version"`})
+	read(rsp)
+	assert.Equal(t, http.StatusPreconditionFailed, rsp.StatusCode)
+	rsp = do(http.MethodDelete, key, nil, map[string]string{"If-Match": etag})
+	read(rsp)
+	assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	rsp = do(http.MethodDelete, "file2", nil, nil)
+	read(rsp)
+	assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+
+	// it shouldn't exist now
+	rsp = do(http.MethodGet, key, nil, nil)
+	read(rsp)
+	assert.Equal(t, http.StatusNotFound, rsp.StatusCode)
+	_, err = client.Stat(cxt, key)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// nothing is served outside the prefix
+	rsp, err = http.Get(svc.URL + "/blobsfile2")
+	if assert.NoError(t, err) {
+		read(rsp)
+		assert.Equal(t, http.StatusNotFound, rsp.StatusCode)
+	}
+
+	// a write the backend fails is reported as its failure, not the caller's
+	failing := httptest.NewServer(New(unavailable{client}))
+	defer failing.Close()
+	req, err := http.NewRequestWithContext(cxt, http.MethodPut, failing.URL+"/file3", strings.NewReader(d1))
+	if assert.NoError(t, err) {
+		rsp, err = http.DefaultClient.Do(req)
+		if assert.NoError(t, err) {
+			read(rsp)
+			assert.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+		}
+	}
+	_, err = client.Stat(cxt, "file3")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+// unavailable is a client whose writes fail as if its service were down
+type unavailable struct {
+	blob.Client
+}
+
+func (c unavailable) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	w, err := c.Client.Write(cxt, rc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return unavailableWriter{w}, nil
+}
+
+type unavailableWriter struct {
+	blob.Writer
+}
+
+func (w unavailableWriter) Write(p []byte) (int, error) {
+	return 0, blob.ErrUnavailable
+}
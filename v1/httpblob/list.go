@@ -0,0 +1,166 @@
+package httpblob
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// Entry describes a resource in a listing. Its key is relative to the path
+// at which the handler is mounted.
+type Entry struct {
+	Key                string            `json:"key"`
+	IsPrefix           bool              `json:"is_prefix,omitempty"`
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	ContentLanguage    string            `json:"content_language,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Size               int64             `json:"size,omitempty"`
+	Created            time.Time         `json:"created"`
+	Updated            time.Time         `json:"updated"`
+	ETag               string            `json:"etag,omitempty"`
+	Generation         int64             `json:"generation,omitempty"`
+	MD5                []byte            `json:"md5,omitempty"`
+	CRC32C             uint32            `json:"crc32c,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// Resource produces the resource an entry describes, with the specified URL
+func (e Entry) Resource(url string) blob.Resource {
+	return blob.Resource{
+		URL:                url,
+		ContentType:        e.ContentType,
+		ContentEncoding:    e.ContentEncoding,
+		ContentDisposition: e.ContentDisposition,
+		ContentLanguage:    e.ContentLanguage,
+		CacheControl:       e.CacheControl,
+		Size:               e.Size,
+		Created:            e.Created,
+		Updated:            e.Updated,
+		ETag:               e.ETag,
+		Generation:         e.Generation,
+		MD5:                e.MD5,
+		CRC32C:             e.CRC32C,
+		Metadata:           e.Metadata,
+		IsPrefix:           e.IsPrefix,
+	}
+}
+
+// Listing is a page of a JSON listing. An NDJSON listing consists of one
+// Entry per line instead, and its next page token is sent in the
+// X-Blob-Next-Page-Token trailer.
+type Listing struct {
+	Entries       []Entry `json:"entries"`
+	NextPageToken string  `json:"next_page_token,omitempty"`
+}
+
+// list produces a listing. It is controlled by the query parameters
+// delimiter, page_size and page_token, which correspond to the ReadOptions
+// of the same names. A listing is produced as NDJSON if the request accepts
+// it or if the format parameter is "ndjson"; otherwise it is JSON.
+func (h *Handler) list(rsp http.ResponseWriter, req *http.Request, key string) {
+	query := req.URL.Query()
+	var opts []blob.ReadOption
+	if v := query.Get("delimiter"); v != "" {
+		opts = append(opts, blob.WithDelimiter(v))
+	}
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(rsp, "Invalid page size", http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, blob.WithPageSize(n))
+	}
+	if v := query.Get("page_token"); v != "" {
+		opts = append(opts, blob.WithPageToken(v))
+	}
+
+	iter, err := h.client.List(req.Context(), key, opts...)
+	if err != nil {
+		handleError(rsp, err)
+		return
+	}
+	defer iter.Close()
+
+	if query.Get("format") == "ndjson" || strings.Contains(req.Header.Get("Accept"), ContentTypeNDJSON) {
+		h.listNDJSON(rsp, iter)
+		return
+	}
+
+	res := Listing{Entries: []Entry{}}
+	for {
+		rc, err := iter.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			handleError(rsp, err)
+			return
+		}
+		res.Entries = append(res.Entries, h.entry(rc))
+	}
+	res.NextPageToken = blob.NextPageToken(iter)
+
+	rsp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rsp).Encode(res)
+}
+
+// listNDJSON streams a listing one entry per line. Once the response has
+// begun the status can no longer be changed, so if the listing fails part
+// way through the response is aborted rather than completed.
+func (h *Handler) listNDJSON(rsp http.ResponseWriter, iter siter.Iterator[blob.Resource]) {
+	rsp.Header().Set("Content-Type", ContentTypeNDJSON)
+	rsp.Header().Set("Trailer", NextPageTokenHeader)
+	enc := json.NewEncoder(rsp)
+	for {
+		rc, err := iter.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		err = enc.Encode(h.entry(rc))
+		if err != nil {
+			return // the client has gone away
+		}
+	}
+	rsp.Header().Set(NextPageTokenHeader, blob.NextPageToken(iter))
+}
+
+// entry describes a resource in a listing
+func (h *Handler) entry(rc blob.Resource) Entry {
+	return Entry{
+		Key:                h.relative(rc.URL),
+		IsPrefix:           rc.IsPrefix,
+		ContentType:        rc.ContentType,
+		ContentEncoding:    rc.ContentEncoding,
+		ContentDisposition: rc.ContentDisposition,
+		ContentLanguage:    rc.ContentLanguage,
+		CacheControl:       rc.CacheControl,
+		Size:               rc.Size,
+		Created:            rc.Created,
+		Updated:            rc.Updated,
+		ETag:               rc.ETag,
+		Generation:         rc.Generation,
+		MD5:                rc.MD5,
+		CRC32C:             rc.CRC32C,
+		Metadata:           rc.Metadata,
+	}
+}
+
+// relative produces the key for a resource URL
+func (h *Handler) relative(u string) string {
+	if strings.HasPrefix(u, h.root) {
+		return strings.TrimPrefix(u[len(h.root):], "/")
+	}
+	if !strings.Contains(u, "://") {
+		return strings.TrimPrefix(u, "/")
+	}
+	return u
+}
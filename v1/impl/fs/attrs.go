@@ -0,0 +1,136 @@
+package fs
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+
+	"github.com/bww/go-blob/v1"
+)
+
+// attrs describe the attributes of a file which the filesystem has no way to
+// represent. They are stored in a hidden sidecar file alongside the file they
+// describe and, like any other dotfile, the sidecar is not itself listed.
+type attrs struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	ContentLanguage    string            `json:"content_language,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// With produces a copy of these attributes, overridden by any that are set
+// in the provided configuration
+func (a attrs) With(conf blob.WriteConfig) attrs {
+	if v := conf.ContentType; v != "" {
+		a.ContentType = v
+	}
+	if v := conf.ContentEncoding; v != "" {
+		a.ContentEncoding = v
+	}
+	if v := conf.ContentDisposition; v != "" {
+		a.ContentDisposition = v
+	}
+	if v := conf.ContentLanguage; v != "" {
+		a.ContentLanguage = v
+	}
+	if v := conf.CacheControl; v != "" {
+		a.CacheControl = v
+	}
+	if v := conf.Metadata; v != nil {
+		a.Metadata = v
+	}
+	return a
+}
+
+func (a attrs) IsZero() bool {
+	return a.ContentType == "" && a.ContentEncoding == "" && a.ContentDisposition == "" && a.ContentLanguage == "" && a.CacheControl == "" && len(a.Metadata) == 0
+}
+
+// Apply sets these attributes on a resource
+func (a attrs) Apply(rc blob.Resource) blob.Resource {
+	if v := a.ContentType; v != "" {
+		rc.ContentType = v
+	}
+	rc.ContentEncoding = a.ContentEncoding
+	rc.ContentDisposition = a.ContentDisposition
+	rc.ContentLanguage = a.ContentLanguage
+	rc.CacheControl = a.CacheControl
+	rc.Metadata = a.Metadata
+	return rc
+}
+
+// sidecar produces the name of the file which stores the attributes of the
+// file with the specified name, alongside it
+func sidecar(name string) string {
+	return "." + name + ".attrs"
+}
+
+// readAttrs reads the attributes of the file at the specified path; a file
+// with no sidecar simply has no attributes
+func (c *Client) readAttrs(p string) (attrs, error) {
+	f, err := c.open(path.Join(path.Dir(p), sidecar(path.Base(p))))
+	if os.IsNotExist(err) {
+		return attrs{}, nil
+	} else if err != nil {
+		return attrs{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return attrs{}, err
+	}
+	var a attrs
+	err = json.Unmarshal(data, &a)
+	if err != nil {
+		return attrs{}, err
+	}
+	return a, nil
+}
+
+// writeAttrs replaces the attributes of the named file in a directory; if
+// there are none to store, any existing sidecar is removed. Like files, the
+// sidecar is replaced atomically and optionally synced.
+func writeAttrs(d *dir, name string, a attrs, sync bool) error {
+	if a.IsZero() {
+		return removeAttrs(d, name)
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	f, err := d.createTemp("." + name + ".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := path.Base(f.Name())
+	err = f.Chmod(0644)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil && sync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = d.rename(tmp, d, sidecar(name))
+	}
+	if err != nil {
+		d.remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// removeAttrs removes the attributes of the named file in a directory
+func removeAttrs(d *dir, name string) error {
+	err := d.remove(sidecar(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
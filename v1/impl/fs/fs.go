@@ -2,11 +2,17 @@ package fs
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/url"
 	"os"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/bww/go-blob/v1"
@@ -24,12 +30,21 @@ const (
 )
 
 type Config struct {
-	Logger *slog.Logger
+	// Deprecated: Logger is ignored; wrap the client with the logging package
+	// to log its operations.
+	Logger   *slog.Logger
+	Sync     bool          // flush written files and their directories to stable storage before they are visible
+	Symlinks SymlinkPolicy // how symbolic links under the root are treated
+}
+
+func init() {
+	blob.Register(Scheme, blob.NewFactory(New))
 }
 
 type Client struct {
-	root string
-	log  *slog.Logger
+	root     string
+	sync     bool
+	symlinks SymlinkPolicy
 }
 
 func New(cxt context.Context, rc string) (*Client, error) {
@@ -42,60 +57,90 @@ func NewWithConfig(cxt context.Context, rc string, conf Config) (*Client, error)
 		return nil, err
 	}
 	return &Client{
-		root: u.Path,
-		log:  conf.Logger,
+		root:     path.Clean(u.Path),
+		sync:     conf.Sync,
+		symlinks: conf.Symlinks,
 	}, nil
 }
 
-func (c *Client) path(rc string) (string, error) {
-	var p string
-	if strings.HasPrefix(rc, schemePrefix) {
-		u, err := url.Parse(rc)
-		if err != nil {
-			return "", err
-		}
-		p = u.Path
-	} else {
-		p = rc
-	}
-	if strings.HasPrefix(p, c.root) {
-		return p, nil
-	} else {
-		return path.Join(c.root, p), nil
-	}
+// wrap describes an error produced by an operation on a resource. Errors
+// from the os package are classified by blob.Kind.
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, nil, *err)
 }
 
-func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpInit, c.String(), &err)
 	return os.MkdirAll(c.root, 0750)
 }
 
-func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
 	p, err := c.path(rc)
 	if err != nil {
 		return nil, err
 	}
-	if c.log != nil {
-		c.log.Info("read", "rc", rc, "root", c.root)
-	}
-	r, err := os.Open(p)
+	r, err := c.open(p)
 	if err != nil && os.IsNotExist(err) {
 		return nil, blob.ErrNotFound
 	} else if err != nil {
 		return nil, err
 	}
-	return r, nil
+	if conf.Offset == 0 && conf.Length <= 0 {
+		return r, nil
+	}
+	l, err := readRange(r, conf.Offset, conf.Length)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return l, nil
 }
 
-func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
-	p, err := c.path(rc)
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// readRange positions a file at offset and limits reads from it to length
+// bytes, or to the end of the file if length is zero or less
+func readRange(f *os.File, offset, length int64) (io.ReadCloser, error) {
+	v, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-	if c.log != nil {
-		c.log.Info("list", "rc", rc, "root", c.root)
+	if offset > v.Size() {
+		return nil, fmt.Errorf("%w: offset %d exceeds size %d", blob.ErrInvalidRange, offset, v.Size())
 	}
+	if offset < 0 {
+		offset = max(v.Size()+offset, 0)
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return f, nil
+	}
+	return rangeReader{io.LimitReader(f, length), f}, nil
+}
 
-	r, err := os.Open(p)
+// List iterates over the files under a directory. Directories are the only
+// hierarchy the filesystem has, so the only delimiter supported is "/".
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (_ siter.Iterator[blob.Resource], err error) {
+	defer wrap(blob.OpList, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if d := conf.Delimiter; d != "" && d != "/" {
+		return nil, fmt.Errorf("%w: delimiter %q", blob.ErrNotSupported, d)
+	}
+	p, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+	u := schemePrefix + p // resources are identified by URL, as they are by Stat
+
+	r, err := c.open(p)
 	if err != nil && os.IsNotExist(err) {
 		return nil, blob.ErrNotFound
 	} else if err != nil {
@@ -107,70 +152,189 @@ func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (
 		return nil, err
 	}
 	if !v.IsDir() { // short circut for single-element result
-		return siter.NewWithSlice(cxt, []blob.Resource{{
-			URL: rc,
-		}}), nil
+		r.Close()
+		res, err := c.describe(u, p, v)
+		if err != nil {
+			return nil, err
+		}
+		return blob.NewPageIterator(siter.NewWithSlice(cxt, []blob.Resource{res})), nil
+	}
+
+	var after []string
+	if conf.PageToken != "" {
+		t, err := base64.RawURLEncoding.DecodeString(conf.PageToken)
+		if err != nil || len(t) == 0 {
+			r.Close()
+			return nil, fmt.Errorf("%w: %q", blob.ErrInvalidToken, conf.PageToken)
+		}
+		after = strings.Split(string(t), "/")
 	}
 
 	iter := siter.NewWithContext(cxt, make(chan siter.Result[blob.Resource], pagelen))
+	page := blob.NewPageIterator(iter)
 	go func() {
 		defer iter.Close()
-		err := c.list(cxt, rc, p, iter, r)
-		if err != nil {
-			iter.Cancel(err)
-			return
+		defer r.Close()
+		l := &lister{client: c, cxt: cxt, conf: conf, iter: iter, after: after}
+		err := l.list(u, p, nil, r)
+		if errors.Is(err, errPageFull) {
+			page.SetNextPageToken(base64.RawURLEncoding.EncodeToString([]byte(strings.Join(l.last, "/"))))
+		} else if err != nil {
+			iter.Cancel(blob.NewError(blob.OpList, rc, nil, err))
 		}
 	}()
 
-	return iter, nil
+	return page, nil
 }
 
-func (c *Client) list(cxt context.Context, rc, prefix string, iter siter.Writer[blob.Resource], f *os.File) error {
-	dirs, err := f.ReadDir(pagelen)
-	if err == io.EOF {
-		return nil // end of input
-	} else if err != nil {
+// errPageFull is used internally to stop listing once a page is full and we
+// know that at least one more entry follows it
+var errPageFull = errors.New("Page is full")
+
+// lister walks a directory tree in order. Entries are produced in the order
+// of their path components, which is stable, so the relative path of the
+// last entry on a page serves as the cursor from which the next one resumes.
+type lister struct {
+	client *Client
+	cxt    context.Context
+	conf   blob.ReadConfig
+	iter   siter.Writer[blob.Resource]
+	after  []string // resume after this entry, if any
+	last   []string // the last entry produced
+	count  int
+}
+
+func (l *lister) list(rc, prefix string, rel []string, f *os.File) error {
+	dirs, err := f.ReadDir(-1)
+	if err != nil {
 		return err
 	}
+	slices.SortFunc(dirs, func(a, b os.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
 	for _, dir := range dirs {
-		if !contexts.Continue(cxt) {
+		if !contexts.Continue(l.cxt) {
 			break // canceled
 		}
 		name := dir.Name()
 		if strings.HasPrefix(name, ".") {
 			continue // skip dotfiles
 		}
-		if dir.IsDir() {
-			p := path.Join(prefix, name)
-			d, err := os.Open(p)
+		key := append(slices.Clip(rel), name)
+		if dir.IsDir() && l.conf.Delimiter == "" {
+			if c := slices.Compare(key, l.after); l.after != nil && c < 0 && !isAncestor(key, l.after) {
+				continue // entirely before the cursor
+			}
+			d, err := l.client.open(path.Join(prefix, name))
 			if err != nil {
 				return err
 			}
-			err = c.list(cxt, urls.Join(rc, name), path.Join(prefix, name), iter, d)
+			err = l.list(urls.Join(rc, name), path.Join(prefix, name), key, d)
+			d.Close()
 			if err != nil {
 				return err
 			}
+			continue
+		}
+		if l.after != nil && slices.Compare(key, l.after) <= 0 {
+			continue // at or before the cursor
+		}
+
+		var res blob.Resource
+		if dir.IsDir() {
+			res = blob.Resource{
+				URL:      urls.Join(rc, name) + "/",
+				IsPrefix: true,
+			}
 		} else {
-			err = iter.Write(blob.Resource{
-				URL: urls.Join(rc, name),
-			})
+			v, err := dir.Info()
+			if os.IsNotExist(err) {
+				continue // removed since we read the directory
+			} else if err != nil {
+				return err
+			}
+			res, err = l.client.describe(urls.Join(rc, name), path.Join(prefix, name), v)
 			if err != nil {
 				return err
 			}
 		}
+		if n := l.conf.PageSize; n > 0 && l.count >= n {
+			return errPageFull
+		}
+		err = l.iter.Write(res)
+		if err != nil {
+			return err
+		}
+		l.last = key
+		l.count++
 	}
 	return nil
 }
 
-func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
+// isAncestor determines whether the path described by components a is a
+// directory which contains the path described by b
+func isAncestor(a, b []string) bool {
+	return len(a) < len(b) && slices.Equal(a, b[:len(a)])
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (_ blob.Resource, err error) {
+	defer wrap(blob.OpStat, rc, &err)
+	p, err := c.path(rc)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	v, err := c.stat(p)
+	if err != nil && os.IsNotExist(err) {
+		return blob.Resource{}, blob.ErrNotFound
+	} else if err != nil {
+		return blob.Resource{}, err
+	}
+	if v.IsDir() { // directories are not resources
+		return blob.Resource{}, blob.ErrNotFound
+	}
+	return c.describe(schemePrefix+p, p, v)
+}
+
+// describe produces a description of the file at the specified path,
+// including the attributes stored alongside it
+func (c *Client) describe(rc, p string, v os.FileInfo) (blob.Resource, error) {
+	a, err := c.readAttrs(p)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	return a.Apply(resource(rc, v)), nil
+}
+
+// resource describes a file. A file is rewritten in its entirety whenever it
+// is updated, so its creation and modification times are the same, and its
+// modification time serves as its generation.
+func resource(rc string, v os.FileInfo) blob.Resource {
+	mod := v.ModTime()
+	return blob.Resource{
+		URL:         rc,
+		ContentType: mime.TypeByExtension(path.Ext(v.Name())),
+		Size:        v.Size(),
+		Created:     mod,
+		Updated:     mod,
+		ETag:        fmt.Sprintf("%x-%x", mod.UnixNano(), v.Size()),
+		Generation:  mod.UnixNano(),
+	}
+}
+
+// Accessor produces a file URL for a resource. A file URL cannot expire or
+// carry response headers and it is only read, so any accessor options other
+// than the default are not supported.
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (_ string, err error) {
+	defer wrap(blob.OpAccessor, rc, &err)
 	p, err := c.path(rc)
 	if err != nil {
 		return "", err
 	}
-	if c.log != nil {
-		c.log.Info("accessor", "rc", rc, "root", c.root)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if !conf.IsAccessorDefault() {
+		return "", fmt.Errorf("%w: accessor options", blob.ErrNotSupported)
 	}
-	_, err = os.Stat(p)
+	_, err = c.stat(p)
 	if err != nil {
 		return "", err
 	}
@@ -180,36 +344,478 @@ func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOptio
 	}).String(), nil
 }
 
-func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (io.WriteCloser, error) {
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
 	p, err := c.path(rc)
 	if err != nil {
 		return nil, err
 	}
+	err = c.match(p, conf)
+	if err != nil {
+		return nil, err
+	}
+	d, name, err := c.parent(p, true)
+	if err != nil {
+		return nil, err
+	}
+	w, err := create(cxt, d, name, conf, attrs{}.With(conf), c.sync)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return w, nil
+}
 
-	d := path.Dir(p)
-	_, err = os.Stat(d)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(d, 0750)
+// writer writes a file and stores its attributes once it has been written.
+// Data is staged in a temporary file alongside the destination, which only
+// replaces it once it has been written in its entirety, so readers never
+// observe a partially written file.
+type writer struct {
+	*os.File
+	cxt         context.Context
+	dir         *dir   // the directory which contains the file
+	name        string // the name of the file
+	tmp         string // the name of the temporary file
+	dst         string
+	attrs       attrs
+	ifNotExists bool
+	sync        bool
+	aborted     bool
+	closed      bool
+}
+
+// Abort discards the staged data
+func (w *writer) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	w.aborted, w.closed = true, true
+	defer w.dir.Close()
+	w.File.Close()
+	return w.dir.remove(w.tmp)
+}
+
+func (w *writer) Close() (err error) {
+	defer wrap(blob.OpWrite, w.dst, &err)
+	if w.aborted {
+		return blob.ErrAborted
+	}
+	if err := w.cxt.Err(); err != nil {
+		w.Abort(err)
+		return err // canceled; nothing is stored
+	}
+	w.closed = true
+	defer w.dir.Close()
+	err = w.commit()
+	if err != nil {
+		w.dir.remove(w.tmp)
+		return err
+	}
+	return nil
+}
+
+func (w *writer) commit() error {
+	if w.sync {
+		err := w.File.Sync()
+		if err != nil {
+			w.File.Close()
+			return err
+		}
+	}
+	err := w.File.Close()
+	if err != nil {
+		return err
+	}
+	if w.ifNotExists {
+		// unlike renaming, linking never replaces the destination
+		err = w.dir.link(w.tmp, w.dir, w.name)
+		if err != nil && os.IsExist(err) {
+			return blob.ErrPreconditionFailed
+		} else if err != nil {
+			return err
+		}
+		err = w.dir.remove(w.tmp)
+	} else {
+		err = w.dir.rename(w.tmp, w.dir, w.name)
+	}
+	if err != nil {
+		return err
 	}
+	err = writeAttrs(w.dir, w.name, w.attrs, w.sync)
+	if err != nil {
+		return err
+	}
+	if w.sync {
+		return syncDir(w.dir.path)
+	}
+	return nil
+}
+
+// create opens a temporary file for writing, which replaces the named file
+// in a directory with the provided attributes when it is closed. The writer
+// closes the directory once it is done with it. Temporary files are
+// dotfiles, so they are never listed.
+func create(cxt context.Context, d *dir, name string, conf blob.WriteConfig, a attrs, sync bool) (*writer, error) {
+	f, err := d.createTemp("." + name + ".*.tmp")
 	if err != nil {
 		return nil, err
 	}
+	tmp := path.Base(f.Name())
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+		d.remove(tmp)
+		return nil, err
+	}
+	return &writer{
+		File:        f,
+		cxt:         cxt,
+		dir:         d,
+		name:        name,
+		tmp:         tmp,
+		dst:         path.Join(d.path, name),
+		attrs:       a,
+		ifNotExists: conf.IfNotExists,
+		sync:        sync,
+	}, nil
+}
+
+// syncDir flushes a directory to stable storage, which makes the creation or
+// renaming of the files in it durable
+func syncDir(p string) error {
+	d, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// match checks that the file at the specified path satisfies the existence
+// and version preconditions in the provided configuration, if any. Files
+// carry no version of their own and there is no way to atomically compare
+// and update one, so this is a best-effort check which is subject to races
+// with other writers; the existence precondition is enforced again when a
+// file is written.
+func (c *Client) match(p string, conf blob.WriteConfig) error {
+	if !conf.IfNotExists && conf.IfMatch == "" {
+		return nil
+	}
+	v, err := c.stat(p)
+	if err != nil && os.IsNotExist(err) {
+		if conf.IfMatch != "" {
+			return blob.ErrPreconditionFailed
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if conf.IfNotExists {
+		return blob.ErrPreconditionFailed
+	}
+	rc := resource(p, v)
+	if conf.IfMatch != rc.ETag && conf.IfMatch != strconv.FormatInt(rc.Generation, 10) {
+		return blob.ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	sp, err := c.path(src)
+	if err != nil {
+		return err
+	}
+	dp, err := c.path(dst)
+	if err != nil {
+		return err
+	}
 
-	if c.log != nil {
-		c.log.Info("write", "rc", rc, "root", c.root)
+	r, err := c.open(sp)
+	if err != nil && os.IsNotExist(err) {
+		return blob.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	a, err := c.readAttrs(sp)
+	if err != nil {
+		return err
 	}
-	return os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	err = c.match(dp, conf)
+	if err != nil {
+		return err
+	}
+	d, name, err := c.parent(dp, sp != dp)
+	if err != nil {
+		return err
+	}
+	if sp == dp {
+		// the content is already in place, but overridden attributes still apply
+		defer d.Close()
+		return writeAttrs(d, name, a.With(conf), c.sync)
+	}
+	w, err := create(cxt, d, name, conf, a.With(conf), c.sync)
+	if err != nil {
+		d.Close()
+		return err
+	}
+	_, err = io.Copy(w, r) // files are copied by the kernel where supported
+	if err != nil {
+		w.Abort(err)
+		return err
+	}
+	return w.Close()
 }
 
-func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	sp, err := c.path(src)
+	if err != nil {
+		return err
+	}
+	dp, err := c.path(dst)
+	if err != nil {
+		return err
+	}
+	if sp == dp {
+		return nil // nothing to do
+	}
+
+	sd, sname, err := c.parent(sp, false)
+	if err != nil && os.IsNotExist(err) {
+		return blob.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	defer sd.Close()
+	v, err := sd.lstat(sname)
+	if err != nil && os.IsNotExist(err) {
+		return blob.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if v.IsDir() { // directories are not resources
+		return blob.ErrNotFound
+	}
+	err = c.match(dp, conf)
+	if err != nil {
+		return err
+	}
+	a, err := c.readAttrs(sp)
+	if err != nil {
+		return err
+	}
+	dd, dname, err := c.parent(dp, true)
+	if err != nil {
+		return err
+	}
+	defer dd.Close()
+	if conf.IfNotExists {
+		// unlike renaming, linking never replaces the destination
+		err = sd.link(sname, dd, dname)
+		if err != nil && os.IsExist(err) {
+			return blob.ErrPreconditionFailed
+		} else if err != nil {
+			return err
+		}
+		err = sd.remove(sname)
+	} else {
+		err = sd.rename(sname, dd, dname)
+	}
+	if err != nil {
+		return err
+	}
+	err = writeAttrs(dd, dname, a.With(conf), c.sync)
+	if err != nil {
+		return err
+	}
+	err = removeAttrs(sd, sname)
+	if err != nil {
+		return err
+	}
+	if c.sync {
+		err = syncDir(path.Dir(dp))
+		if err == nil && path.Dir(sp) != path.Dir(dp) {
+			err = syncDir(path.Dir(sp))
+		}
+	}
+	return err
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDelete, rc, &err)
 	p, err := c.path(rc)
 	if err != nil {
 		return err
 	}
-	if c.log != nil {
-		c.log.Info("delete", "rc", rc, "root", c.root)
+	err = c.match(p, blob.WriteConfig{}.WithOptions(opts))
+	if err != nil {
+		return err
+	}
+	return c.remove(p)
+}
+
+// remove removes a file under the root and its attributes. Directories are
+// not resources, so they are never removed; only pruned once they are empty.
+func (c *Client) remove(p string) error {
+	d, name, err := c.parent(p, false)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	v, err := d.lstat(name)
+	if err != nil {
+		return err
+	}
+	if v.IsDir() {
+		return fmt.Errorf("%w: %q is a directory", blob.ErrNotFound, p)
+	}
+	err = d.remove(name)
+	if err != nil {
+		return err
+	}
+	return removeAttrs(d, name)
+}
+
+// DeleteMany deletes files concurrently, then removes any directories left
+// empty. Files which do not exist are ignored.
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeleteMany, c.String(), &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	err = blob.Concurrently(cxt, conf.Concurrency, urls, func(cxt context.Context, u string) (err error) {
+		defer wrap(blob.OpDelete, u, &err)
+		p, err := c.path(u)
+		if err != nil {
+			return err
+		}
+		err = c.remove(p)
+		if err != nil && blob.Kind(err) != blob.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+
+	dirs := make(map[string]struct{})
+	for _, u := range urls {
+		if p, perr := c.path(u); perr == nil {
+			dirs[path.Dir(p)] = struct{}{}
+		}
+	}
+	for d := range dirs {
+		c.prune(d)
+	}
+	return err
+}
+
+// DeletePrefix deletes the file or directory tree at a path, then removes any
+// directories left empty. The root itself is emptied but never removed.
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeletePrefix, prefix, &err)
+	p, err := c.path(prefix)
+	if err != nil {
+		return err
+	}
+	p = path.Clean(p)
+	err = c.removeAll(p)
+	if err != nil {
+		return err
+	}
+	c.prune(path.Dir(p))
+	return nil
+}
+
+// removeAll removes the file or directory tree at a path under the root. The
+// root itself is emptied but never removed.
+func (c *Client) removeAll(p string) error {
+	if p == path.Clean(c.root) {
+		d, err := openDir(c.root, ".", c.symlinks)
+		if os.IsNotExist(err) {
+			return nil // nothing to delete
+		} else if err != nil {
+			return err
+		}
+		defer d.Close()
+		return removeEntries(d)
+	}
+	d, name, err := c.parent(p, false)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer d.Close()
+	return removeTree(d, name)
+}
+
+// removeTree removes a file or directory tree from a directory. Each
+// directory is opened in its parent and nothing is followed, so a symbolic
+// link is removed rather than what it refers to, even if one replaces a
+// directory while the tree is being removed.
+func removeTree(d *dir, name string) error {
+	v, err := d.lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !v.IsDir() {
+		err = d.remove(name)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	sub, err := d.sub(name)
+	if err != nil {
+		return err
+	}
+	err = removeEntries(sub)
+	sub.Close()
+	if err != nil {
+		return err
+	}
+	return d.rmdir(name)
+}
+
+// removeEntries removes everything in a directory
+func removeEntries(d *dir) error {
+	names, err := d.names()
+	if err != nil {
+		return err
+	}
+	for _, e := range names {
+		err = removeTree(d, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes a directory under the root and each of its parents, until
+// one which is not empty is encountered
+func (c *Client) prune(d string) {
+	root := path.Clean(c.root)
+	for d = path.Clean(d); strings.HasPrefix(d, root+"/"); d = path.Dir(d) {
+		if c.rmdir(d) != nil {
+			break // not empty, or otherwise can't be removed
+		}
+	}
+}
+
+// rmdir removes an empty directory under the root
+func (c *Client) rmdir(p string) error {
+	d, name, err := c.parent(p, false)
+	if err != nil {
+		return err
 	}
-	return os.Remove(p)
+	defer d.Close()
+	return d.rmdir(name)
 }
 
 func (c *Client) String() string {
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log/slog"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/internal/conformance"
 	siter "github.com/bww/go-iterator/v1"
 	"github.com/bww/go-util/v1/errors"
 	"github.com/bww/go-util/v1/text"
@@ -25,7 +27,7 @@ func TestFSCRUD(t *testing.T) {
 	root := text.Coalesce(os.Getenv("GOBLOB_FS_ROOT"), errors.Must(os.Getwd()))
 
 	base := "file://" + root
-	store, err := NewWithConfig(cxt, base, Config{Logger: slog.Default()})
+	store, err := New(cxt, base)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -99,6 +101,372 @@ func TestFSCRUD(t *testing.T) {
 		return
 	}
 
+	// a write in progress isn't visible until it's closed; this client also
+	// syncs what it writes
+	synced, err := NewWithConfig(cxt, base, Config{Sync: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = synced.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1[:7]))
+		assert.NoError(t, err)
+		r, err := store.Read(cxt, dsn)
+		if assert.NoError(t, err) {
+			d, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, d2, string(d))
+			assert.NoError(t, r.Close())
+		}
+		_, err = w.Write([]byte(d1[7:]))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		r, err = store.Read(cxt, dsn)
+		if assert.NoError(t, err) {
+			d, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, d1, string(d))
+			assert.NoError(t, r.Close())
+		}
+	}
+
+	// put the second version back
+	w, err = synced.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d2))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// read part of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r3, err := store.Read(cxt, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		d5, err := io.ReadAll(r3)
+		assert.NoError(t, err)
+		assert.Equal(t, "this", string(d5))
+		assert.NoError(t, r3.Close())
+	}
+
+	// read the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r4, err := store.Read(cxt, dsn, blob.WithOffset(-5))
+	if assert.NoError(t, err) {
+		d6, err := io.ReadAll(r4)
+		assert.NoError(t, err)
+		assert.Equal(t, "data.", string(d6))
+		assert.NoError(t, r4.Close())
+	}
+
+	// read beyond the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// describe the resource without reading it
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	s1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, base+"/file1", s1.URL)
+		assert.Equal(t, int64(len(d2)), s1.Size)
+		assert.NotEmpty(t, s1.ETag)
+		assert.False(t, s1.Updated.IsZero())
+	}
+
+	// and it is described the same way when it is listed
+	l1, err := siter.CollectErr(store.List(cxt, dsn))
+	if assert.NoError(t, err) && assert.Len(t, l1, 1) {
+		assert.Equal(t, s1.URL, l1[0].URL)
+	}
+
+	// a directory is not a resource
+	dsn = "/"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// copy the resource, overriding its content type
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "copy/file2", blob.WithContentType("text/plain"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// move the copy somewhere else
+	dsn = "copy/file2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Move(cxt, dsn, "file3")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the copy is no longer where it was
+	dsn = "copy/file2"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// but the moved copy has the same content as the original
+	dsn = "file3"
+	fmt.Printf("<= %s\n", dsn)
+	r5, err := store.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d7, err := io.ReadAll(r5)
+		assert.NoError(t, err)
+		assert.Equal(t, d2, string(d7))
+		assert.NoError(t, r5.Close())
+	}
+
+	// we're done with it
+	dsn = "file3"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.NoError(t, store.Delete(cxt, dsn))
+
+	// a resource that doesn't exist can't be copied
+	dsn = "fileZ"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "file3")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// an aborted write stores nothing, even after being closed, nor does a
+	// write whose context ends before it is closed
+	conformance.Abort(t, cxt, store, "aborted1")
+
+	// conditionally create a resource
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// but only once
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	_, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// find out which version we have
+	dsn = "cond1"
+	fmt.Printf("<= %s\n", dsn)
+	c1, err := store.Stat(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// an update that expects some other version fails
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	_, err = store.Write(cxt, dsn, blob.WithIfMatch("not-the-version"))
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// an update that expects the current version succeeds
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfMatch(c1.ETag))
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d2))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// the version we had is now stale, so it can't be used to delete
+	dsn = "cond1"
+	fmt.Printf("~~ %s\n", dsn)
+	err = store.Delete(cxt, dsn, blob.WithIfMatch(c1.ETag))
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// but the current version can
+	dsn = "cond1"
+	fmt.Printf("<= %s\n", dsn)
+	c2, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		fmt.Printf("~~ %s\n", dsn)
+		err = store.Delete(cxt, dsn, blob.WithIfMatch(strconv.FormatInt(c2.Generation, 10)))
+		assert.NoError(t, err)
+	}
+
+	// write a resource with attributes
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn,
+		blob.WithContentType("text/plain"),
+		blob.WithCacheControl("no-cache"),
+		blob.WithContentDisposition(`attachment; filename="meta1.txt"`),
+		blob.WithContentLanguage("en"),
+		blob.WithMetadata(map[string]string{"owner": "tests"}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// the attributes are described along with the resource
+	dsn = "meta1"
+	fmt.Printf("<= %s\n", dsn)
+	m1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/plain", m1.ContentType)
+		assert.Equal(t, "no-cache", m1.CacheControl)
+		assert.Equal(t, `attachment; filename="meta1.txt"`, m1.ContentDisposition)
+		assert.Equal(t, "en", m1.ContentLanguage)
+		assert.Equal(t, map[string]string{"owner": "tests"}, m1.Metadata)
+	}
+
+	// copies preserve the attributes that aren't overridden
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "meta2", blob.WithContentType("application/json"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, "meta2")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "no-cache", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// including a copy onto itself
+	dsn = "meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, dsn, blob.WithCacheControl("max-age=60"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "max-age=60", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// delete resources in bulk, then everything under a prefix
+	for _, e := range []string{"bulk/a", "bulk/b", "bulk/c/d", "bulk/c/e"} {
+		w, err = store.Write(cxt, e)
+		if assert.NoError(t, err) {
+			_, err = w.Write([]byte(d1))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+		}
+	}
+	err = blob.DeleteMany(cxt, store, []string{"bulk/a", "bulk/c/d", "bulk/missing"}, blob.WithConcurrency(2))
+	assert.NoError(t, err)
+	_, err = store.Stat(cxt, "bulk/a")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "bulk/b")
+	assert.NoError(t, err)
+	err = blob.DeletePrefix(cxt, store, "bulk/")
+	assert.NoError(t, err)
+	for _, e := range []string{"bulk/b", "bulk/c/e"} {
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+	_, err = os.Stat(root + "/bulk")
+	assert.True(t, os.IsNotExist(err), "empty directories should be removed")
+
+	// directories aren't resources, so they can't be deleted as one
+	assert.NoError(t, os.MkdirAll(root+"/empty", 0750))
+	assert.ErrorIs(t, store.Delete(cxt, "empty"), blob.ErrNotFound)
+	_, err = os.Stat(root + "/empty")
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(root+"/empty"))
+	// clean up
+	assert.NoError(t, store.Delete(cxt, "meta1"))
+	assert.NoError(t, store.Delete(cxt, "meta2"))
+
+	// resources can't escape the root, even when they share its prefix
+	for _, e := range []string{"../file1", "dir/../../file1", root + "/../file1", "file://" + root + "-other/file1", "file:///etc/passwd"} {
+		fmt.Printf("<= %s\n", e)
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrInvalidURL, e)
+	}
+	_, err = store.Stat(cxt, root+"-other/file1") // just a path under the root
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "dir/../file1") // still under the root
+	assert.NoError(t, err)
+
+	// symbolic links are subject to a policy, which only permits those which
+	// stay under the root by default
+	outside := t.TempDir()
+	assert.NoError(t, os.WriteFile(outside+"/secret", []byte(d1), 0644))
+	assert.NoError(t, os.MkdirAll(root+"/links", 0750))
+	assert.NoError(t, os.Symlink(outside, root+"/links/out"))
+	assert.NoError(t, os.Symlink(root+"/file1", root+"/links/in"))
+	for policy, allowed := range map[SymlinkPolicy][]bool{
+		SymlinksWithinRoot: {false, true},
+		SymlinksDeny:       {false, false},
+		SymlinksFollow:     {true, true},
+	} {
+		linked, err := NewWithConfig(cxt, base, Config{Symlinks: policy})
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for i, e := range []string{"links/out/secret", "links/in"} {
+			fmt.Printf("<= %s (%d)\n", e, policy)
+			r, err := linked.Read(cxt, e)
+			if allowed[i] {
+				if assert.NoError(t, err, e) {
+					r.Close()
+				}
+			} else {
+				assert.ErrorIs(t, err, blob.ErrInvalidURL, e)
+			}
+			_, err = linked.Write(cxt, e+"/new")
+			if !allowed[i] {
+				assert.ErrorIs(t, err, blob.ErrInvalidURL, e)
+			}
+		}
+	}
+	assert.NoError(t, os.RemoveAll(root+"/links"))
+
+	// so is a directory which is replaced by a link after a path through it
+	// has been checked, whatever is done with the path
+	assert.NoError(t, os.MkdirAll(root+"/swap", 0750))
+	p, err := store.path("swap/secret")
+	if assert.NoError(t, err) {
+		assert.NoError(t, os.Remove(root+"/swap"))
+		assert.NoError(t, os.Symlink(outside, root+"/swap"))
+		_, err = store.stat(p)
+		assert.ErrorIs(t, err, blob.ErrInvalidURL)
+		assert.ErrorIs(t, store.remove(p), blob.ErrInvalidURL)
+		_, _, err = store.parent(p, true)
+		assert.ErrorIs(t, err, blob.ErrInvalidURL)
+		_, err = os.Stat(outside + "/secret")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, os.Remove(root+"/swap"))
+	assert.NoError(t, os.MkdirAll(root+"/swap/tree", 0750))
+	p, err = store.path("swap/tree")
+	if assert.NoError(t, err) {
+		assert.NoError(t, os.RemoveAll(root+"/swap"))
+		assert.NoError(t, os.Symlink(outside, root+"/swap"))
+		assert.NoError(t, os.MkdirAll(outside+"/tree", 0750))
+		assert.ErrorIs(t, store.removeAll(p), blob.ErrInvalidURL)
+		_, err = os.Stat(outside + "/tree")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, os.Remove(root+"/swap"))
+
+	// deleting a tree removes the links in it, not what they refer to
+	assert.NoError(t, os.MkdirAll(root+"/tree", 0750))
+	assert.NoError(t, os.Symlink(outside, root+"/tree/out"))
+	assert.NoError(t, store.DeletePrefix(cxt, "tree"))
+	_, err = os.Lstat(root + "/tree")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(outside + "/secret")
+	assert.NoError(t, err)
+
 	// obtain an accessor for the resource, which is just a file:// url
 	dsn = "file1"
 	fmt.Printf("<= %s\n", dsn)
@@ -113,6 +481,16 @@ func TestFSCRUD(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, base+"/file1", a2)
 
+	// file URLs can't do anything but the default
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Accessor(cxt, dsn, blob.WithMethod("GET"))
+	assert.NoError(t, err)
+	_, err = store.Accessor(cxt, dsn, blob.WithExpiry(time.Minute))
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+	_, err = store.Accessor(cxt, dsn, blob.WithMethod("PUT"))
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
 	// delete our file
 	dsn = "file1"
 	fmt.Printf("~~ %s\n", dsn)
@@ -125,23 +503,35 @@ func TestFSCRUD(t *testing.T) {
 	dsn = base + "/file1"
 	fmt.Printf("~~ %s\n", dsn)
 	err = store.Delete(cxt, dsn)
-	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	assert.ErrorIs(t, err, os.ErrNotExist) // the cause is retained
+	var berr *blob.Error
+	if assert.ErrorAs(t, err, &berr) {
+		assert.Equal(t, blob.OpDelete, berr.Op)
+		assert.Equal(t, dsn, berr.URL)
+	}
 
 	// it still shouldn't exist now
 	dsn = base + "/file1"
 	fmt.Printf("<= %s\n", dsn)
 	_, err = store.Read(cxt, dsn)
-	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// nor can it be described
+	dsn = base + "/file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
 
 	// accessors also don't work on nonexistent files
 	dsn = base + "/file1"
 	fmt.Printf("<= %s\n", dsn)
 	_, err = store.Accessor(cxt, dsn)
-	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
 
 	// create a store for tree traversal
 	base = "file://" + fixt
-	store, err = NewWithConfig(cxt, base, Config{Logger: slog.Default()})
+	store, err = New(cxt, base)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -160,6 +550,8 @@ func TestFSCRUD(t *testing.T) {
 			p := rc.URL[len(base):]
 			fmt.Printf("<... %v\n", p)
 			tree[p] = struct{}{}
+			assert.NotEmpty(t, rc.ETag)
+			assert.False(t, rc.Updated.IsZero())
 		}
 	}
 
@@ -171,4 +563,47 @@ func TestFSCRUD(t *testing.T) {
 		"/C":     {},
 	}, tree)
 
+	// page through the same listing, a few entries at a time
+	var paged []string
+	for token := ""; ; {
+		iter, err := store.List(cxt, base, blob.WithPageSize(2), blob.WithPageToken(token))
+		if !assert.NoError(t, err) {
+			break
+		}
+		res, err := siter.CollectErr(iter, nil)
+		if !assert.NoError(t, err) || !assert.LessOrEqual(t, len(res), 2) {
+			break
+		}
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			paged = append(paged, rc.URL[len(base):])
+		}
+		if token = blob.NextPageToken(iter); token == "" {
+			break
+		}
+	}
+	if assert.Len(t, paged, len(tree)) {
+		for _, e := range paged {
+			assert.Contains(t, tree, e)
+		}
+	}
+	_, err = store.List(cxt, base, blob.WithPageToken("not a token"))
+	assert.ErrorIs(t, err, blob.ErrInvalidToken)
+
+	// list only the immediate children of the prefix
+	res, err := siter.CollectErr(store.List(cxt, base, blob.WithDelimiter("/")))
+	if assert.NoError(t, err) {
+		children := make(map[string]bool)
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			children[rc.URL[len(base):]] = rc.IsPrefix
+		}
+		assert.Equal(t, map[string]bool{
+			"/A":  false,
+			"/B":  false,
+			"/C":  false,
+			"/Z/": true,
+		}, children)
+	}
+
 }
@@ -0,0 +1,216 @@
+package fs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bww/go-blob/v1"
+)
+
+// SymlinkPolicy determines how symbolic links under the root are treated
+// when the path of a resource is resolved
+type SymlinkPolicy int
+
+const (
+	// SymlinksWithinRoot follows symbolic links which resolve to a path under
+	// the root and rejects any which do not. This is the default.
+	SymlinksWithinRoot SymlinkPolicy = iota
+	// SymlinksDeny rejects any path which traverses a symbolic link
+	SymlinksDeny
+	// SymlinksFollow follows symbolic links wherever they lead
+	SymlinksFollow
+)
+
+// path resolves a resource to a path under the root. A resource is either a
+// file URL or a path, which is relative to the root unless it is already
+// under it. Resources which would escape the root, either lexically or by
+// way of a symbolic link the policy does not permit, are invalid.
+func (c *Client) path(rc string) (string, error) {
+	rel, err := c.key(rc)
+	if err != nil {
+		return "", err
+	}
+	if c.symlinks != SymlinksFollow {
+		err = resolve(c.root, rel, c.symlinks)
+		if err != nil {
+			return "", err
+		}
+	}
+	return path.Join(c.root, rel), nil
+}
+
+// key produces the path of a resource relative to the root
+func (c *Client) key(rc string) (string, error) {
+	var p string
+	if strings.HasPrefix(rc, schemePrefix) {
+		u, err := url.Parse(rc)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", blob.ErrInvalidURL, err)
+		}
+		rel, ok := c.within(u.Path)
+		if !ok {
+			return "", fmt.Errorf("%w: %q is not under %q", blob.ErrInvalidURL, rc, c.root)
+		}
+		p = rel
+	} else if rel, ok := c.within(rc); ok {
+		p = rel
+	} else {
+		p = rc
+	}
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		return ".", nil
+	}
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("%w: %q escapes %q", blob.ErrInvalidURL, rc, c.root)
+	}
+	return path.Clean(p), nil
+}
+
+// within determines whether a path is the root or under it and, if so,
+// produces the path relative to the root. Paths are compared by component,
+// so a sibling which shares a prefix with the root is not under it.
+func (c *Client) within(p string) (string, bool) {
+	return relative(c.root, p)
+}
+
+func relative(root, p string) (string, bool) {
+	switch {
+	case p == root:
+		return "", true
+	case root == "/":
+		return p[1:], strings.HasPrefix(p, "/")
+	case strings.HasPrefix(p, root+"/"):
+		return p[len(root)+1:], true
+	default:
+		return "", false
+	}
+}
+
+// resolveLinks checks each component of a clean path relative to the root
+// against a symlink policy. Components which do not exist yet are not
+// checked. Unlike resolution by the kernel,
+// this is subject to races with concurrent changes to the tree.
+func resolveLinks(root, rel string, policy SymlinkPolicy) error {
+	if rel == "." {
+		return nil // the root itself is not subject to the policy
+	}
+	canon, err := filepath.EvalSymlinks(root)
+	if os.IsNotExist(err) {
+		return nil // nothing exists yet
+	} else if err != nil {
+		return err
+	}
+	dir := root
+	for _, e := range strings.Split(rel, "/") {
+		next := path.Join(dir, e)
+		v, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			return nil // nothing more to traverse
+		} else if err != nil {
+			return err
+		}
+		if v.Mode()&os.ModeSymlink == 0 {
+			dir = next
+			continue
+		}
+		if policy == SymlinksDeny {
+			return fmt.Errorf("%w: %q traverses a symbolic link", blob.ErrInvalidURL, rel)
+		}
+		target, err := filepath.EvalSymlinks(next)
+		if os.IsNotExist(err) {
+			return nil // dangling; there is nothing to traverse
+		} else if err != nil {
+			return err
+		}
+		if _, ok := relative(canon, target); !ok {
+			return fmt.Errorf("%w: %q links outside %q", blob.ErrInvalidURL, rel, root)
+		}
+		dir = target
+	}
+	return nil
+}
+
+// open opens a file under the root for reading, subject to the symlink
+// policy
+func (c *Client) open(p string) (*os.File, error) {
+	if c.symlinks == SymlinksFollow {
+		return os.Open(p)
+	}
+	rel, ok := c.within(p)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not under %q", blob.ErrInvalidURL, p, c.root)
+	}
+	if rel == "" {
+		rel = "."
+	}
+	return openBeneath(c.root, rel, c.symlinks)
+}
+
+// stat describes a file under the root, subject to the symlink policy
+func (c *Client) stat(p string) (os.FileInfo, error) {
+	if c.symlinks == SymlinksFollow {
+		return os.Stat(p)
+	}
+	rel, ok := c.within(p)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not under %q", blob.ErrInvalidURL, p, c.root)
+	}
+	if rel == "" {
+		rel = "."
+	}
+	return statBeneath(c.root, rel, c.symlinks)
+}
+
+// parent opens the directory which contains a file under the root, subject
+// to the symlink policy, and produces the name of the file in it. If create
+// is set, the directory and any of its parents which don't exist are
+// created.
+func (c *Client) parent(p string, create bool) (*dir, string, error) {
+	rel, ok := c.within(p)
+	if !ok || rel == "" {
+		return nil, "", fmt.Errorf("%w: %q is not under %q", blob.ErrInvalidURL, p, c.root)
+	}
+	if create {
+		err := c.mkdirAll(path.Dir(rel))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	d, err := openDir(c.root, path.Dir(rel), c.symlinks)
+	if err != nil {
+		return nil, "", err
+	}
+	return d, path.Base(rel), nil
+}
+
+// mkdirAll creates a directory relative to the root and any of its parents
+// which don't exist. Each one is created in its parent, which is opened
+// subject to the symlink policy.
+func (c *Client) mkdirAll(rel string) error {
+	if rel == "." {
+		return os.MkdirAll(c.root, 0750)
+	}
+	d, err := openDir(c.root, rel, c.symlinks)
+	if err == nil {
+		return d.Close() // already exists
+	}
+	err = c.mkdirAll(path.Dir(rel))
+	if err != nil {
+		return err
+	}
+	d, err = openDir(c.root, path.Dir(rel), c.symlinks)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	err = d.mkdir(path.Base(rel))
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
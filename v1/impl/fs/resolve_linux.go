@@ -0,0 +1,259 @@
+//go:build linux
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bww/go-blob/v1"
+	"golang.org/x/sys/unix"
+)
+
+// resolveFlags produces the openat2 resolution flags which enforce a symlink
+// policy. Resolution never leaves the directory it starts from.
+func resolveFlags(policy SymlinkPolicy) uint64 {
+	if policy == SymlinksDeny {
+		return unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS
+	}
+	return unix.RESOLVE_BENEATH
+}
+
+// openat2 opens a path relative to the root, which is resolved by the
+// kernel according to the symlink policy, so it is not subject to races
+// with concurrent changes to the tree. Errors from the call itself are
+// returned as they are.
+func openat2(root, rel string, flags int, policy SymlinkPolicy) (int, error) {
+	dir, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	defer unix.Close(dir)
+	how := &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Resolve: resolveFlags(policy),
+	}
+	for {
+		fd, err := unix.Openat2(dir, rel, how)
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue // interrupted, or raced with a rename; try again
+		}
+		return fd, err
+	}
+}
+
+// fallback determines whether an openat2 failure must be settled by
+// checking the path component by component instead: either the call is not
+// available, or the path traverses an absolute symbolic link, which the
+// kernel never permits beneath a directory but which may still resolve to
+// a path under the root.
+func fallback(err error, policy SymlinkPolicy) bool {
+	return err == unix.ENOSYS || (err == unix.EXDEV && policy == SymlinksWithinRoot)
+}
+
+// pathError describes an openat2 failure
+func pathError(root, rel string, err error) error {
+	if err == unix.EXDEV || err == unix.ELOOP {
+		return fmt.Errorf("%w: %q escapes %q", blob.ErrInvalidURL, rel, root)
+	}
+	return &os.PathError{Op: "openat2", Path: path.Join(root, rel), Err: err}
+}
+
+// resolve checks a path relative to the root against a symlink policy. The
+// longest prefix of it which exists is resolved, since the rest may be
+// about to be created.
+func resolve(root, rel string, policy SymlinkPolicy) error {
+	for {
+		fd, err := openat2(root, rel, unix.O_PATH, policy)
+		switch {
+		case err == nil:
+			return unix.Close(fd)
+		case fallback(err, policy):
+			return resolveLinks(root, rel, policy)
+		case errors.Is(err, unix.ENOENT), errors.Is(err, unix.ENOTDIR):
+			if rel == "." {
+				return nil // nothing exists yet
+			}
+			rel = path.Dir(rel)
+		default:
+			return pathError(root, rel, err)
+		}
+	}
+}
+
+// openBeneath opens a file under the root for reading, subject to a symlink
+// policy
+func openBeneath(root, rel string, policy SymlinkPolicy) (*os.File, error) {
+	fd, err := openat2(root, rel, unix.O_RDONLY, policy)
+	if fallback(err, policy) {
+		err = resolveLinks(root, rel, policy)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(path.Join(root, rel))
+	} else if err != nil {
+		return nil, pathError(root, rel, err)
+	}
+	return os.NewFile(uintptr(fd), path.Join(root, rel)), nil
+}
+
+// statBeneath describes a file under the root, subject to a symlink policy
+func statBeneath(root, rel string, policy SymlinkPolicy) (os.FileInfo, error) {
+	fd, err := openat2(root, rel, unix.O_PATH, policy)
+	if fallback(err, policy) {
+		err = resolveLinks(root, rel, policy)
+		if err != nil {
+			return nil, err
+		}
+		return os.Stat(path.Join(root, rel))
+	} else if err != nil {
+		return nil, pathError(root, rel, err)
+	}
+	f := os.NewFile(uintptr(fd), path.Join(root, rel))
+	defer f.Close()
+	return f.Stat()
+}
+
+// dir is a directory under the root, in which files are created, renamed and
+// removed by name. The directory is resolved by the kernel when it is
+// opened and those operations are relative to it, so they can't be
+// redirected outside the root by changes to the tree above it.
+type dir struct {
+	fd   int
+	path string
+}
+
+// openDir opens a directory relative to the root, subject to a symlink
+// policy
+func openDir(root, rel string, policy SymlinkPolicy) (*dir, error) {
+	p := path.Join(root, rel)
+	if policy == SymlinksFollow {
+		fd, err := unix.Open(p, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: p, Err: err}
+		}
+		return &dir{fd: fd, path: p}, nil
+	}
+	fd, err := openat2(root, rel, unix.O_PATH|unix.O_DIRECTORY, policy)
+	if fallback(err, policy) {
+		err = resolveLinks(root, rel, policy)
+		if err != nil {
+			return nil, err
+		}
+		fd, err = unix.Open(p, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: p, Err: err}
+		}
+	} else if err != nil {
+		return nil, pathError(root, rel, err)
+	}
+	return &dir{fd: fd, path: p}, nil
+}
+
+func (d *dir) Close() error {
+	return unix.Close(d.fd)
+}
+
+// lstat describes a file in the directory without following it, if it is a
+// symbolic link
+func (d *dir) lstat(name string) (os.FileInfo, error) {
+	fd, err := unix.Openat(d.fd, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path.Join(d.path, name), Err: err}
+	}
+	f := os.NewFile(uintptr(fd), path.Join(d.path, name))
+	defer f.Close()
+	return f.Stat()
+}
+
+// mkdir creates a directory in the directory
+func (d *dir) mkdir(name string) error {
+	err := unix.Mkdirat(d.fd, name, 0750)
+	if err != nil {
+		return &os.PathError{Op: "mkdirat", Path: path.Join(d.path, name), Err: err}
+	}
+	return nil
+}
+
+// createTemp creates a new file in the directory for reading and writing,
+// named by replacing the last "*" in pattern with a random string
+func (d *dir) createTemp(pattern string) (*os.File, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for i := 0; ; i++ {
+		name := prefix + strconv.FormatUint(uint64(rand.Uint32()), 10) + suffix
+		fd, err := unix.Openat(d.fd, name, unix.O_RDWR|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC, 0600)
+		if err == unix.EEXIST && i < 10000 {
+			continue
+		} else if err != nil {
+			return nil, &os.PathError{Op: "createtemp", Path: path.Join(d.path, pattern), Err: err}
+		}
+		return os.NewFile(uintptr(fd), path.Join(d.path, name)), nil
+	}
+}
+
+// rename renames a file in the directory to a name in another one
+func (d *dir) rename(name string, to *dir, toname string) error {
+	err := unix.Renameat(d.fd, name, to.fd, toname)
+	if err != nil {
+		return &os.LinkError{Op: "renameat", Old: path.Join(d.path, name), New: path.Join(to.path, toname), Err: err}
+	}
+	return nil
+}
+
+// link links a file in the directory to a name in another one, which must
+// not exist
+func (d *dir) link(name string, to *dir, toname string) error {
+	err := unix.Linkat(d.fd, name, to.fd, toname, 0)
+	if err != nil {
+		return &os.LinkError{Op: "linkat", Old: path.Join(d.path, name), New: path.Join(to.path, toname), Err: err}
+	}
+	return nil
+}
+
+// remove removes a file from the directory; directories are never removed
+func (d *dir) remove(name string) error {
+	err := unix.Unlinkat(d.fd, name, 0)
+	if err != nil {
+		return &os.PathError{Op: "unlinkat", Path: path.Join(d.path, name), Err: err}
+	}
+	return nil
+}
+
+// sub opens a directory in the directory. A symbolic link is never
+// followed, even to a directory.
+func (d *dir) sub(name string) (*dir, error) {
+	p := path.Join(d.path, name)
+	fd, err := unix.Openat(d.fd, name, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: p, Err: err}
+	}
+	return &dir{fd: fd, path: p}, nil
+}
+
+// names lists the names of the files in the directory
+func (d *dir) names() ([]string, error) {
+	fd, err := unix.Openat(d.fd, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: d.path, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), d.path)
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// rmdir removes an empty directory from the directory
+func (d *dir) rmdir(name string) error {
+	err := unix.Unlinkat(d.fd, name, unix.AT_REMOVEDIR)
+	if err != nil {
+		return &os.PathError{Op: "unlinkat", Path: path.Join(d.path, name), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+//go:build !linux
+
+package fs
+
+import (
+	"os"
+	"path"
+	"syscall"
+)
+
+// resolve checks a path relative to the root against a symlink policy
+func resolve(root, rel string, policy SymlinkPolicy) error {
+	return resolveLinks(root, rel, policy)
+}
+
+// openBeneath opens a file under the root for reading, subject to a symlink
+// policy. The path is checked before it is opened, so this is subject to
+// races with concurrent changes to the tree.
+func openBeneath(root, rel string, policy SymlinkPolicy) (*os.File, error) {
+	err := resolveLinks(root, rel, policy)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path.Join(root, rel))
+}
+
+// statBeneath describes a file under the root, subject to a symlink policy.
+// The path is checked before it is described, so this is subject to races
+// with concurrent changes to the tree.
+func statBeneath(root, rel string, policy SymlinkPolicy) (os.FileInfo, error) {
+	err := resolveLinks(root, rel, policy)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path.Join(root, rel))
+}
+
+// dir is a directory under the root, in which files are created, renamed and
+// removed by name. Without a means of resolving a directory once and then
+// operating relative to it, the directory is checked when it is opened and
+// operations are performed by path, so they are subject to races with
+// concurrent changes to the tree.
+type dir struct {
+	path string
+}
+
+// openDir opens a directory relative to the root, subject to a symlink
+// policy
+func openDir(root, rel string, policy SymlinkPolicy) (*dir, error) {
+	if policy != SymlinksFollow {
+		err := resolveLinks(root, rel, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p := path.Join(root, rel)
+	v, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: p, Err: syscall.ENOTDIR}
+	}
+	return &dir{path: p}, nil
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+// lstat describes a file in the directory without following it, if it is a
+// symbolic link
+func (d *dir) lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(path.Join(d.path, name))
+}
+
+// mkdir creates a directory in the directory
+func (d *dir) mkdir(name string) error {
+	return os.Mkdir(path.Join(d.path, name), 0750)
+}
+
+// createTemp creates a new file in the directory for reading and writing,
+// named by replacing the last "*" in pattern with a random string
+func (d *dir) createTemp(pattern string) (*os.File, error) {
+	return os.CreateTemp(d.path, pattern)
+}
+
+// rename renames a file in the directory to a name in another one
+func (d *dir) rename(name string, to *dir, toname string) error {
+	return os.Rename(path.Join(d.path, name), path.Join(to.path, toname))
+}
+
+// link links a file in the directory to a name in another one, which must
+// not exist
+func (d *dir) link(name string, to *dir, toname string) error {
+	return os.Link(path.Join(d.path, name), path.Join(to.path, toname))
+}
+
+// remove removes a file from the directory; directories are never removed
+func (d *dir) remove(name string) error {
+	p := path.Join(d.path, name)
+	v, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if v.IsDir() {
+		return &os.PathError{Op: "remove", Path: p, Err: syscall.EISDIR}
+	}
+	return os.Remove(p)
+}
+
+// sub opens a directory in the directory. A symbolic link is never
+// followed, even to a directory.
+func (d *dir) sub(name string) (*dir, error) {
+	p := path.Join(d.path, name)
+	v, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: p, Err: syscall.ENOTDIR}
+	}
+	return &dir{path: p}, nil
+}
+
+// names lists the names of the files in the directory
+func (d *dir) names() ([]string, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// rmdir removes an empty directory from the directory
+func (d *dir) rmdir(name string) error {
+	p := path.Join(d.path, name)
+	v, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if !v.IsDir() {
+		return &os.PathError{Op: "rmdir", Path: p, Err: syscall.ENOTDIR}
+	}
+	return os.Remove(p)
+}
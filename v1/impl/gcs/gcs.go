@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	siter "github.com/bww/go-iterator/v1"
 	"github.com/bww/go-util/v1/contexts"
 	"github.com/bww/go-util/v1/urls"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -28,13 +32,18 @@ var ErrInvalidBucket = errors.New("Invalid bucket")
 
 type Config struct {
 	BucketAttrs *storage.BucketAttrs
-	Logger      *slog.Logger
+	// Deprecated: Logger is ignored; wrap the client with the logging package
+	// to log its operations.
+	Logger *slog.Logger
+}
+
+func init() {
+	blob.Register(Scheme, blob.NewFactory(New))
 }
 
 type Client struct {
 	client    *storage.Client
 	bucket    *storage.BucketHandle
-	log       *slog.Logger
 	projectId string
 	prefix    string
 	fqbp      string // fully-qualified bucket prefix
@@ -57,7 +66,6 @@ func NewWithConfig(cxt context.Context, rc string, conf Config) (*Client, error)
 	return &Client{
 		client:    client,
 		bucket:    client.Bucket(dsn.Prefix),
-		log:       conf.Logger,
 		projectId: dsn.ProjectId,
 		prefix:    dsn.Prefix,
 		fqbp:      fmt.Sprintf("%s%s/%s/", schemePrefix, dsn.ProjectId, dsn.Prefix),
@@ -75,8 +83,9 @@ func (c *Client) path(rc string) (string, error) {
 	return rc[len(c.fqbp):], nil
 }
 
-func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
-	_, err := c.bucket.Attrs(cxt)
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpInit, c.String(), &err)
+	_, err = c.bucket.Attrs(cxt)
 	if err == nil {
 		return nil // already exists
 	} else if !errors.Is(err, storage.ErrBucketNotExist) {
@@ -91,34 +100,57 @@ func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
 	return c.bucket.Create(cxt, c.projectId, attrs)
 }
 
-func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
-	rc, err := c.path(rc)
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	rc, err = c.path(rc)
 	if err != nil {
 		return nil, err
 	}
-	if c.log != nil {
-		c.log.Info("read", "rc", rc)
+	length := conf.Length
+	if length <= 0 || conf.Offset < 0 {
+		length = -1 // read to the end; a range relative to it is limited below
+	}
+	obj := c.bucket.Object(rc)
+	if conf.Compressed {
+		obj = obj.ReadCompressed(true) // don't transcode gzipped content
 	}
-	r, err := c.bucket.Object(rc).NewReader(cxt)
+	r, err := obj.NewRangeReader(cxt, conf.Offset, length)
 	if errors.Is(err, storage.ErrObjectNotExist) {
 		return nil, blob.ErrNotFound
+	} else if isStatus(err, http.StatusRequestedRangeNotSatisfiable) {
+		return nil, fmt.Errorf("%w: %v", blob.ErrInvalidRange, err)
 	} else if err != nil {
 		return nil, err
 	}
+	if conf.Offset < 0 && conf.Length > 0 {
+		return rangeReader{io.LimitReader(r, conf.Length), r}, nil
+	}
 	return r, nil
 }
 
-func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
-	rc, err := c.path(rc)
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (_ siter.Iterator[blob.Resource], err error) {
+	defer wrap(blob.OpList, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	rc, err = c.path(rc)
 	if err != nil {
 		return nil, err
 	}
-	if c.log != nil {
-		c.log.Info("list", "rc", rc)
-	}
 
-	objs := c.bucket.Objects(cxt, &storage.Query{Prefix: rc})
+	objs := c.bucket.Objects(cxt, &storage.Query{Prefix: rc, Delimiter: conf.Delimiter})
 	iter := siter.NewWithContext(cxt, make(chan siter.Result[blob.Resource], pagelen))
+	page := blob.NewPageIterator(iter)
+	if conf.PageSize > 0 {
+		go c.listPage(cxt, rc, objs, conf, iter, page)
+		return page, nil
+	}
+
+	objs.PageInfo().Token = conf.PageToken
 	go func() {
 		defer iter.Close()
 		for contexts.Continue(cxt) {
@@ -127,13 +159,10 @@ func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (
 				// no more elements
 				break
 			} else if err != nil {
-				iter.Cancel(err)
+				iter.Cancel(blob.NewError(blob.OpList, c.fqbp+rc, kind(err), err))
 				break
 			}
-			err = iter.Write(blob.Resource{
-				URL:         urls.Join(c.fqbp, obj.Name),
-				ContentType: obj.ContentType,
-			})
+			err = iter.Write(c.listed(obj))
 			if err != nil {
 				// already canceled
 				break
@@ -141,51 +170,444 @@ func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (
 		}
 	}()
 
-	return iter, nil
+	return page, nil
 }
 
-func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
-	rc, err := c.path(rc)
+// listPage produces a single page of a listing
+func (c *Client) listPage(cxt context.Context, prefix string, objs *storage.ObjectIterator, conf blob.ReadConfig, iter siter.Writer[blob.Resource], page *blob.PageIterator) {
+	defer iter.Close()
+	var res []*storage.ObjectAttrs
+	next, err := iterator.NewPager(objs, conf.PageSize, conf.PageToken).NextPage(&res)
+	if err != nil {
+		iter.Cancel(blob.NewError(blob.OpList, c.fqbp+prefix, kind(err), err))
+		return
+	}
+	for _, obj := range res {
+		err = iter.Write(c.listed(obj))
+		if err != nil {
+			return // already canceled
+		}
+	}
+	page.SetNextPageToken(next)
+}
+
+// listed describes an element of a listing, which may be an object or, when
+// listing with a delimiter, a prefix
+func (c *Client) listed(obj *storage.ObjectAttrs) blob.Resource {
+	if obj.Prefix != "" {
+		return blob.Resource{URL: c.fqbp + obj.Prefix, IsPrefix: true}
+	}
+	return c.resource(obj)
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (_ blob.Resource, err error) {
+	defer wrap(blob.OpStat, rc, &err)
+	rc, err = c.path(rc)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	attrs, err := c.bucket.Object(rc).Attrs(cxt)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return blob.Resource{}, blob.ErrNotFound
+	} else if err != nil {
+		return blob.Resource{}, err
+	}
+	return c.resource(attrs), nil
+}
+
+func (c *Client) resource(attrs *storage.ObjectAttrs) blob.Resource {
+	return blob.Resource{
+		URL:                urls.Join(c.fqbp, attrs.Name),
+		ContentType:        attrs.ContentType,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+		CacheControl:       attrs.CacheControl,
+		Size:               attrs.Size,
+		Created:            attrs.Created,
+		Updated:            attrs.Updated,
+		ETag:               attrs.Etag,
+		Generation:         attrs.Generation,
+		MD5:                attrs.MD5,
+		CRC32C:             attrs.CRC32C,
+		Metadata:           attrs.Metadata,
+	}
+}
+
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (_ string, err error) {
+	defer wrap(blob.OpAccessor, rc, &err)
+	rc, err = c.path(rc)
 	if err != nil {
 		return "", err
 	}
-	if c.log != nil {
-		c.log.Info("accessor", "rc", rc)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	method := conf.Method
+	if method == "" {
+		method = "GET"
+	}
+	expiry := conf.Expiry
+	if expiry <= 0 {
+		expiry = blob.DefaultExpiry
+	}
+	query := make(url.Values)
+	if v := conf.ResponseContentDisposition; v != "" {
+		query.Set("response-content-disposition", v)
+	}
+	for k, v := range conf.Query {
+		query[k] = v
 	}
 	params := &storage.SignedURLOptions{
-		Scheme:  storage.SigningSchemeV4,
-		Method:  "GET",
-		Expires: time.Now().Add(15 * time.Minute),
+		Scheme:          storage.SigningSchemeV4,
+		Method:          method,
+		Expires:         time.Now().Add(expiry),
+		ContentType:     conf.ContentType,
+		QueryParameters: query,
 	}
 	return c.bucket.SignedURL(rc, params)
-
 }
 
-func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (io.WriteCloser, error) {
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
 	conf := blob.WriteConfig{}.WithOptions(opts)
-	rc, err := c.path(rc)
+	rc, err = c.path(rc)
 	if err != nil {
 		return nil, err
 	}
-	if c.log != nil {
-		c.log.Info("write", "rc", rc)
+	obj, err := c.object(cxt, rc, conf)
+	if err != nil {
+		return nil, err
 	}
-	w := c.bucket.Object(rc).NewWriter(cxt)
+	wcxt, cancel := context.WithCancelCause(cxt)
+	w := obj.NewWriter(wcxt)
+	applyAttrs(&w.ObjectAttrs, conf)
+	return &writer{Writer: w, cxt: cxt, url: c.fqbp + rc, cancel: cancel}, nil
+}
+
+// overrides determines whether a configuration sets any object attributes
+func overrides(conf blob.WriteConfig) bool {
+	return conf.ContentType != "" || conf.ContentEncoding != "" || conf.ContentDisposition != "" || conf.ContentLanguage != "" || conf.CacheControl != "" || conf.Metadata != nil
+}
+
+// applyAttrs sets the object attributes described by a configuration
+func applyAttrs(attrs *storage.ObjectAttrs, conf blob.WriteConfig) {
 	if v := conf.ContentType; v != "" {
-		w.ObjectAttrs.ContentType = v
+		attrs.ContentType = v
+	}
+	if v := conf.ContentEncoding; v != "" {
+		attrs.ContentEncoding = v
+	}
+	if v := conf.ContentDisposition; v != "" {
+		attrs.ContentDisposition = v
+	}
+	if v := conf.ContentLanguage; v != "" {
+		attrs.ContentLanguage = v
+	}
+	if v := conf.CacheControl; v != "" {
+		attrs.CacheControl = v
+	}
+	if v := conf.Metadata; v != nil {
+		attrs.Metadata = v
+	}
+}
+
+// writer maps the errors produced when an upload is committed. An upload is
+// aborted by canceling its context, after which it can't be committed.
+type writer struct {
+	*storage.Writer
+	cxt     context.Context
+	url     string
+	cancel  context.CancelCauseFunc
+	aborted bool
+	closed  bool
+}
+
+func (w *writer) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	if err == nil {
+		err = blob.ErrAborted
+	}
+	w.aborted, w.closed = true, true
+	w.cancel(err)
+	w.Writer.Close() // fails, since the upload has been canceled
+	return nil
+}
+
+func (w *writer) Close() (err error) {
+	defer wrap(blob.OpWrite, w.url, &err)
+	if w.aborted {
+		return blob.ErrAborted
+	}
+	w.closed = true
+	if err := w.cxt.Err(); err != nil {
+		w.cancel(err) // canceled; the upload can't be committed
+		w.Writer.Close()
+		return blob.ErrCanceled
+	}
+	defer w.cancel(nil)
+	err = w.Writer.Close()
+	if isStatus(err, http.StatusPreconditionFailed) {
+		return blob.ErrPreconditionFailed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// object obtains a handle to the named object, subject to the preconditions
+// described by the provided configuration
+func (c *Client) object(cxt context.Context, name string, conf blob.WriteConfig) (*storage.ObjectHandle, error) {
+	obj := c.bucket.Object(name)
+	if conf.IfNotExists {
+		return obj.If(storage.Conditions{DoesNotExist: true}), nil
+	}
+	if conf.IfMatch == "" {
+		return obj, nil
+	}
+	gen, err := strconv.ParseInt(conf.IfMatch, 10, 64)
+	if err != nil { // not a generation; it must be an ETag, which we resolve to a generation
+		attrs, err := obj.Attrs(cxt)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, blob.ErrPreconditionFailed
+		} else if err != nil {
+			return nil, err
+		}
+		if attrs.Etag != conf.IfMatch {
+			return nil, blob.ErrPreconditionFailed
+		}
+		gen = attrs.Generation
+	}
+	return obj.If(storage.Conditions{GenerationMatch: gen}), nil
+}
+
+// wrap describes an error produced by an operation on an object, classified
+// by kind
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, kind(*err), *err)
+}
+
+// kind classifies an error produced by the storage client
+func kind(err error) error {
+	if k := blob.Kind(err); k != nil {
+		return k
+	}
+	var gerr *googleapi.Error
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist), errors.Is(err, storage.ErrBucketNotExist):
+		return blob.ErrNotFound
+	case errors.Is(err, ErrInvalidBucket):
+		return blob.ErrInvalidURL
+	case errors.As(err, &gerr):
+		switch gerr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return blob.ErrPermission
+		case http.StatusNotFound:
+			return blob.ErrNotFound
+		case http.StatusConflict:
+			return blob.ErrAlreadyExists
+		case http.StatusPreconditionFailed:
+			return blob.ErrPreconditionFailed
+		case http.StatusRequestedRangeNotSatisfiable:
+			return blob.ErrInvalidRange
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return blob.ErrUnavailable
+		}
+	}
+	return nil
+}
+
+func isStatus(err error, code int) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == code
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	src, err = c.path(src)
+	if err != nil {
+		return err
 	}
-	return w, nil
+	dst, err = c.path(dst)
+	if err != nil {
+		return err
+	}
+	return c.copy(cxt, src, dst, nil, conf)
 }
 
-func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
-	rc, err := c.path(rc)
+// copy copies an object. If the attributes of the source are provided, the
+// generation they describe is copied; otherwise, the current one is.
+func (c *Client) copy(cxt context.Context, src, dst string, attrs *storage.ObjectAttrs, conf blob.WriteConfig) error {
+	dobj, err := c.object(cxt, dst, conf)
 	if err != nil {
 		return err
 	}
-	if c.log != nil {
-		c.log.Info("delete", "rc", rc)
+	sobj := c.bucket.Object(src)
+	if attrs != nil {
+		sobj = sobj.Generation(attrs.Generation)
+	}
+	copier := dobj.CopierFrom(sobj)
+	if overrides(conf) {
+		// Attributes provided to a copier replace those of the source object
+		// entirely, so when we override any of them we must start from the
+		// source attributes in order to preserve the rest.
+		if attrs == nil {
+			attrs, err = sobj.Attrs(cxt)
+			if errors.Is(err, storage.ErrObjectNotExist) {
+				return blob.ErrNotFound
+			} else if err != nil {
+				return err
+			}
+		}
+		copier.ObjectAttrs = storage.ObjectAttrs{
+			ContentType:        attrs.ContentType,
+			ContentLanguage:    attrs.ContentLanguage,
+			ContentEncoding:    attrs.ContentEncoding,
+			ContentDisposition: attrs.ContentDisposition,
+			CacheControl:       attrs.CacheControl,
+			Metadata:           attrs.Metadata,
+		}
+		applyAttrs(&copier.ObjectAttrs, conf)
+	}
+	_, err = copier.Run(cxt)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return blob.ErrNotFound
+	} else if isStatus(err, http.StatusNotFound) { // copier errors are not mapped by the client
+		return blob.ErrNotFound
+	} else if isStatus(err, http.StatusPreconditionFailed) {
+		return blob.ErrPreconditionFailed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	src, err = c.path(src)
+	if err != nil {
+		return err
+	}
+	dst, err = c.path(dst)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil // nothing to do
+	}
+	attrs, err := c.bucket.Object(src).Attrs(cxt)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return blob.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	err = c.copy(cxt, src, dst, attrs, conf)
+	if err != nil {
+		return err
+	}
+	// only the generation which was copied is deleted, so a write to the
+	// source which lands in between isn't lost
+	err = c.bucket.Object(src).If(storage.Conditions{GenerationMatch: attrs.Generation}).Delete(cxt)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil // already removed; the copy succeeded, which is what matters
+	} else if isStatus(err, http.StatusPreconditionFailed) {
+		return fmt.Errorf("%w: %s changed while it was moved; it was copied but not deleted", blob.ErrPreconditionFailed, src)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDelete, rc, &err)
+	rc, err = c.path(rc)
+	if err != nil {
+		return err
+	}
+	obj, err := c.object(cxt, rc, blob.WriteConfig{}.WithOptions(opts))
+	if err != nil {
+		return err
+	}
+	err = obj.Delete(cxt)
+	if isStatus(err, http.StatusPreconditionFailed) {
+		return blob.ErrPreconditionFailed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteMany deletes objects concurrently. Objects which do not exist are
+// ignored.
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeleteMany, c.String(), &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	return blob.Concurrently(cxt, conf.Concurrency, urls, func(cxt context.Context, u string) (err error) {
+		defer wrap(blob.OpDelete, u, &err)
+		name, err := c.path(u)
+		if err != nil {
+			return err
+		}
+		return c.deleteObject(cxt, name)
+	})
+}
+
+// DeletePrefix deletes every object under a prefix concurrently, a page at a
+// time. Only object names are listed, which is considerably cheaper than
+// listing their attributes.
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeletePrefix, prefix, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	rc, err := c.path(prefix)
+	if err != nil {
+		return err
+	}
+	query := &storage.Query{Prefix: rc}
+	err = query.SetAttrSelection([]string{"Name"})
+	if err != nil {
+		return err
+	}
+	pager := iterator.NewPager(c.bucket.Objects(cxt, query), 1000, "")
+	errs := make(map[string]error)
+	for {
+		var page []*storage.ObjectAttrs
+		next, err := pager.NextPage(&page)
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(page))
+		for i, obj := range page {
+			names[i] = obj.Name
+		}
+		var berr *blob.BatchError
+		err = blob.Concurrently(cxt, conf.Concurrency, names, c.deleteObject)
+		if errors.As(err, &berr) {
+			for name, err := range berr.Errors {
+				errs[c.fqbp+name] = blob.NewError(blob.OpDelete, c.fqbp+name, kind(err), err)
+			}
+		} else if err != nil {
+			return err
+		}
+		if next == "" {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return &blob.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// deleteObject deletes the named object, unconditionally; if it does not
+// exist, there is nothing to do
+func (c *Client) deleteObject(cxt context.Context, name string) error {
+	err := c.bucket.Object(name).Delete(cxt)
+	if errors.Is(err, storage.ErrObjectNotExist) || isStatus(err, http.StatusNotFound) {
+		return nil
 	}
-	return c.bucket.Object(rc).Delete(cxt)
+	return err
 }
 
 func (c *Client) String() string {
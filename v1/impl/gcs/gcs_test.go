@@ -1,14 +1,18 @@
 package gcs
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
-	"log/slog"
+	"strconv"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/internal/conformance"
 	siter "github.com/bww/go-iterator/v1"
 	"github.com/bww/go-util/v1/urls"
 	"github.com/stretchr/testify/assert"
@@ -21,7 +25,7 @@ func TestGCSCRUD(t *testing.T) {
 	defer cancel()
 
 	fqbp := "gcs://treno-integration/bucket"
-	store, err := NewWithConfig(cxt, fqbp, Config{Logger: slog.Default()})
+	store, err := New(cxt, fqbp)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -101,12 +105,276 @@ func TestGCSCRUD(t *testing.T) {
 		return
 	}
 
+	// read part of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r3, err := store.Read(cxt, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		d5, err := io.ReadAll(r3)
+		assert.NoError(t, err)
+		assert.Equal(t, "this", string(d5))
+		assert.NoError(t, r3.Close())
+	}
+
+	// read the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r4, err := store.Read(cxt, dsn, blob.WithOffset(-5))
+	if assert.NoError(t, err) {
+		d6, err := io.ReadAll(r4)
+		assert.NoError(t, err)
+		assert.Equal(t, "data.", string(d6))
+		assert.NoError(t, r4.Close())
+	}
+
+	// read part of the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r5, err := store.Read(cxt, dsn, blob.WithRange(-5, 4))
+	if assert.NoError(t, err) {
+		d7, err := io.ReadAll(r5)
+		assert.NoError(t, err)
+		assert.Equal(t, "data", string(d7))
+		assert.NoError(t, r5.Close())
+	}
+
+	// read beyond the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// describe the resource without reading it
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	s1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, urls.Join(fqbp, "file1"), s1.URL)
+		assert.Equal(t, int64(len(d2)), s1.Size)
+		assert.NotEmpty(t, s1.MD5)
+		assert.NotZero(t, s1.Generation)
+	}
+
+	// copy the resource, overriding its content type
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "copy/file2", blob.WithContentType("text/plain"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// move the copy somewhere else
+	dsn = "copy/file2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Move(cxt, dsn, "file3")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the copy is no longer where it was
+	dsn = "copy/file2"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// but the moved copy has the same content as the original
+	dsn = "file3"
+	fmt.Printf("<= %s\n", dsn)
+	r6, err := store.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d8, err := io.ReadAll(r6)
+		assert.NoError(t, err)
+		assert.Equal(t, d2, string(d8))
+		assert.NoError(t, r6.Close())
+	}
+
+	// and the content type we provided
+	dsn = "file3"
+	fmt.Printf("<= %s\n", dsn)
+	s3, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/plain", s3.ContentType)
+	}
+
+	// we're done with it
+	dsn = "file3"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.NoError(t, store.Delete(cxt, dsn))
+
+	// a resource that doesn't exist can't be copied
+	dsn = "fileZ"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "file3")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// an aborted write stores nothing, even after being closed, nor does a
+	// write whose context ends before it is closed
+	conformance.Abort(t, cxt, store, "aborted1")
+
+	// conditionally create a resource
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// but only once; this fails when the upload is committed
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d2))
+		assert.NoError(t, err)
+		assert.ErrorIs(t, w.Close(), blob.ErrPreconditionFailed)
+	}
+
+	// find out which version we have
+	dsn = "cond1"
+	fmt.Printf("<= %s\n", dsn)
+	c1, err := store.Stat(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// an update that expects some other version fails
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfMatch("1"))
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d2))
+		assert.NoError(t, err)
+		assert.ErrorIs(t, w.Close(), blob.ErrPreconditionFailed)
+	}
+
+	// an update that expects the current version succeeds
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfMatch(c1.ETag))
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d2))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// the version we had is now stale, so it can't be used to delete
+	dsn = "cond1"
+	fmt.Printf("~~ %s\n", dsn)
+	err = store.Delete(cxt, dsn, blob.WithIfMatch(c1.ETag))
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// but the current version can
+	dsn = "cond1"
+	fmt.Printf("<= %s\n", dsn)
+	c2, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		fmt.Printf("~~ %s\n", dsn)
+		err = store.Delete(cxt, dsn, blob.WithIfMatch(strconv.FormatInt(c2.Generation, 10)))
+		assert.NoError(t, err)
+	}
+
+	// write a resource with attributes
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn,
+		blob.WithContentType("text/plain"),
+		blob.WithCacheControl("no-cache"),
+		blob.WithContentDisposition(`attachment; filename="meta1.txt"`),
+		blob.WithContentLanguage("en"),
+		blob.WithMetadata(map[string]string{"owner": "tests"}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	// the attributes are described along with the resource; cache control is
+	// not checked because it isn't retained under emulation
+	dsn = "meta1"
+	fmt.Printf("<= %s\n", dsn)
+	m1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "text/plain", m1.ContentType)
+		assert.Equal(t, `attachment; filename="meta1.txt"`, m1.ContentDisposition)
+		assert.Equal(t, "en", m1.ContentLanguage)
+		assert.Equal(t, map[string]string{"owner": "tests"}, m1.Metadata)
+	}
+
+	// copies preserve the attributes that aren't overridden
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "meta2", blob.WithContentType("application/json"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, "meta2")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// gzipped content can be read as it is stored, rather than transcoded
+	dsn = "gzip1"
+	fmt.Printf("=> %s\n", dsn)
+	var gz bytes.Buffer
+	z := gzip.NewWriter(&gz)
+	z.Write([]byte(d1))
+	z.Close()
+	w, err = store.Write(cxt, dsn, blob.WithContentType("text/plain"), blob.WithContentEncoding("gzip"))
+	if assert.NoError(t, err) {
+		_, err = w.Write(gz.Bytes())
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		r, err := store.Read(cxt, dsn, blob.WithReadCompressed())
+		if assert.NoError(t, err) {
+			d, err := io.ReadAll(r)
+			r.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, gz.Bytes(), d)
+		}
+	}
+
+	// delete resources in bulk, then everything under a prefix
+	for _, e := range []string{"bulk/a", "bulk/b", "bulk/c/d", "bulk/c/e"} {
+		w, err = store.Write(cxt, e)
+		if assert.NoError(t, err) {
+			_, err = w.Write([]byte(d1))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+		}
+	}
+	err = blob.DeleteMany(cxt, store, []string{"bulk/a", "bulk/c/d", "bulk/missing"}, blob.WithConcurrency(2))
+	assert.NoError(t, err)
+	_, err = store.Stat(cxt, "bulk/a")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "bulk/b")
+	assert.NoError(t, err)
+	err = blob.DeletePrefix(cxt, store, "bulk/")
+	assert.NoError(t, err)
+	for _, e := range []string{"bulk/b", "bulk/c/e"} {
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+	// clean up
+	assert.NoError(t, store.Delete(cxt, "meta1"))
+	assert.NoError(t, store.Delete(cxt, "meta2"))
+
 	// this file doesn't exist
 	dsn = "fileZ"
 	fmt.Printf("<= %s\n", dsn)
 	_, err = store.Read(cxt, dsn)
 	assert.ErrorIs(t, err, blob.ErrNotFound)
 
+	// so it can't be described either
+	dsn = "fileZ"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
 	// create some files under a directory
 	dsn = "A/file1"
 	fmt.Printf("<= %s\n", dsn)
@@ -140,6 +408,7 @@ func TestGCSCRUD(t *testing.T) {
 			p := rc.URL
 			fmt.Printf("<... %v\n", p)
 			tree[p] = struct{}{}
+			assert.Equal(t, int64(len(d1)), rc.Size)
 		}
 	}
 
@@ -148,6 +417,30 @@ func TestGCSCRUD(t *testing.T) {
 		urls.Join(fqbp, "A/B/file1"): {},
 	}, tree)
 
+	// list a single page; the emulator limits the size of a page but doesn't
+	// produce a token for the next one, so we can't page any further here
+	iter, err = store.List(cxt, "A/", blob.WithPageSize(1))
+	if assert.NoError(t, err) {
+		res, err := siter.CollectErr(iter, nil)
+		if assert.NoError(t, err) {
+			assert.Len(t, res, 1)
+		}
+	}
+
+	// list only the immediate children of the prefix
+	res, err := siter.CollectErr(store.List(cxt, "A/", blob.WithDelimiter("/")))
+	if assert.NoError(t, err) {
+		children := make(map[string]bool)
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			children[rc.URL] = rc.IsPrefix
+		}
+		assert.Equal(t, map[string]bool{
+			urls.Join(fqbp, "A/file1"):   false,
+			urls.Join(fqbp, "A/B") + "/": true,
+		}, children)
+	}
+
 	// this doesn't work under emulation; we expect failure but we should try to improve this
 	dsn = "file1"
 	fmt.Printf("<= %s\n", dsn)
@@ -172,13 +465,19 @@ func TestGCSCRUD(t *testing.T) {
 	dsn = "gcs://treno-integration/bucket/file1"
 	fmt.Printf("~~ %s\n", dsn)
 	err = store.Delete(cxt, dsn)
-	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	assert.ErrorIs(t, err, storage.ErrObjectNotExist) // the cause is retained
+	var berr *blob.Error
+	if assert.ErrorAs(t, err, &berr) {
+		assert.Equal(t, blob.OpDelete, berr.Op)
+		assert.Equal(t, dsn, berr.URL)
+	}
 
 	// it still shouldn't exist now
 	dsn = "file1"
 	fmt.Printf("<= %s\n", dsn)
 	_, err = store.Read(cxt, dsn)
-	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
 
 	// check it this way
 	dsn = "gcs://treno-integration/bucket/file1"
@@ -0,0 +1,587 @@
+// Package http is a blob backend for a remote blob service that speaks the
+// protocol served by httpblob. It allows clients without credentials for the
+// underlying storage to read and write through a gateway.
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/httpblob"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/bww/go-util/v1/contexts"
+)
+
+const pagelen = 64
+
+const (
+	Scheme    = "http"
+	SchemeTLS = "https"
+)
+
+type Config struct {
+	// Deprecated: Logger is ignored; wrap the client with the logging package
+	// to log its operations.
+	Logger *slog.Logger
+	Client *nethttp.Client // the client used to make requests; if nil, the default client is used
+	Header nethttp.Header  // headers included in every request; for example, Authorization
+}
+
+func init() {
+	blob.Register(Scheme, blob.NewFactory(New))
+	blob.Register(SchemeTLS, blob.NewFactory(New))
+}
+
+type Client struct {
+	client *nethttp.Client
+	header nethttp.Header
+	fqbp   string // fully-qualified base path
+}
+
+func New(cxt context.Context, rc string) (*Client, error) {
+	return NewWithConfig(cxt, rc, Config{})
+}
+
+func NewWithConfig(cxt context.Context, rc string, conf Config) (*Client, error) {
+	u, err := url.Parse(rc)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != Scheme && u.Scheme != SchemeTLS) || u.Host == "" {
+		return nil, fmt.Errorf("%w: expected an HTTP URL: %q", blob.ErrInvalidURL, rc)
+	}
+	client := conf.Client
+	if client == nil {
+		client = nethttp.DefaultClient
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return &Client{
+		client: client,
+		header: conf.Header,
+		fqbp:   strings.TrimSuffix(u.String(), "/") + "/",
+	}, nil
+}
+
+func (c *Client) path(rc string) (string, error) {
+	if strings.HasPrefix(rc, c.fqbp) {
+		return rc[len(c.fqbp):], nil
+	}
+	if strings.HasPrefix(rc, Scheme+"://") || strings.HasPrefix(rc, SchemeTLS+"://") {
+		return "", fmt.Errorf("%w: expected prefix %q in %q", blob.ErrInvalidURL, c.fqbp, rc)
+	}
+	return strings.TrimPrefix(rc, "/"), nil // just a path
+}
+
+// endpoint produces the URL of the resource with the specified key, with
+// each element of the key escaped
+func (c *Client) endpoint(key string) string {
+	parts := strings.Split(key, "/")
+	for i, e := range parts {
+		parts[i] = url.PathEscape(e)
+	}
+	return c.fqbp + strings.Join(parts, "/")
+}
+
+func (c *Client) request(cxt context.Context, method, u string, body io.Reader) (*nethttp.Request, error) {
+	req, err := nethttp.NewRequestWithContext(cxt, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	// resources are stored with their content encoding, which the transport
+	// must not decode on our behalf
+	req.Header.Set("Accept-Encoding", "identity")
+	return req, nil
+}
+
+// do performs a request; if the response is not successful it is consumed
+// and an error describing it is returned
+func (c *Client) do(req *nethttp.Request) (*nethttp.Response, error) {
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		defer rsp.Body.Close()
+		return nil, errorFrom(rsp)
+	}
+	return rsp, nil
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return nil // nothing to do; the service is managed elsewhere
+}
+
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.request(cxt, nethttp.MethodGet, c.endpoint(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if v := byteRange(conf); v != "" {
+		req.Header.Set("Range", v)
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Offset < 0 && conf.Length > 0 { // a suffix range can't also be limited
+		return rangeReader{io.LimitReader(rsp.Body, conf.Length), rsp.Body}, nil
+	}
+	return rsp.Body, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// byteRange produces the Range header for the range described by a
+// configuration, if any
+func byteRange(conf blob.ReadConfig) string {
+	switch {
+	case conf.Offset < 0:
+		return fmt.Sprintf("bytes=%d", conf.Offset)
+	case conf.Length > 0:
+		return fmt.Sprintf("bytes=%d-%d", conf.Offset, conf.Offset+conf.Length-1)
+	case conf.Offset > 0:
+		return fmt.Sprintf("bytes=%d-", conf.Offset)
+	default:
+		return ""
+	}
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (_ siter.Iterator[blob.Resource], err error) {
+	defer wrap(blob.OpList, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"list": {""}}
+	if v := conf.Delimiter; v != "" {
+		query.Set("delimiter", v)
+	}
+	if v := conf.PageSize; v > 0 {
+		query.Set("page_size", strconv.Itoa(v))
+	}
+	if v := conf.PageToken; v != "" {
+		query.Set("page_token", v)
+	}
+	req, err := c.request(cxt, nethttp.MethodGet, c.endpoint(key)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", httpblob.ContentTypeNDJSON)
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := siter.NewWithContext(cxt, make(chan siter.Result[blob.Resource], pagelen))
+	page := blob.NewPageIterator(iter)
+	go func() {
+		defer iter.Close()
+		defer rsp.Body.Close()
+		scanner := bufio.NewScanner(rsp.Body)
+		for scanner.Scan() && contexts.Continue(cxt) {
+			var e httpblob.Entry
+			err := json.Unmarshal(scanner.Bytes(), &e)
+			if err != nil {
+				iter.Cancel(blob.NewError(blob.OpList, c.fqbp+key, kind(err), err))
+				return
+			}
+			err = iter.Write(e.Resource(c.resolve(e.Key)))
+			if err != nil {
+				return // already canceled
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			iter.Cancel(blob.NewError(blob.OpList, c.fqbp+key, kind(err), err))
+			return
+		}
+		// the trailer is only available once the body has been consumed
+		page.SetNextPageToken(rsp.Trailer.Get(httpblob.NextPageTokenHeader))
+	}()
+
+	return page, nil
+}
+
+// resolve produces the URL of a resource listed by the service; keys which
+// the service could not make relative are already URLs
+func (c *Client) resolve(key string) string {
+	if strings.Contains(key, "://") {
+		return key
+	}
+	return c.fqbp + key
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (_ blob.Resource, err error) {
+	defer wrap(blob.OpStat, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	return c.stat(cxt, key)
+}
+
+func (c *Client) stat(cxt context.Context, key string) (blob.Resource, error) {
+	req, err := c.request(cxt, nethttp.MethodHead, c.endpoint(key), nil)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	rsp.Body.Close()
+
+	hdr := rsp.Header
+	res := blob.Resource{
+		URL:                c.fqbp + key,
+		ContentType:        hdr.Get("Content-Type"),
+		ContentEncoding:    hdr.Get("Content-Encoding"),
+		ContentDisposition: hdr.Get("Content-Disposition"),
+		ContentLanguage:    hdr.Get("Content-Language"),
+		CacheControl:       hdr.Get("Cache-Control"),
+		Size:               rsp.ContentLength,
+		ETag:               unquote(hdr.Get("ETag")),
+		Metadata:           httpblob.Metadata(hdr),
+	}
+	if v := hdr.Get("Last-Modified"); v != "" {
+		if t, err := nethttp.ParseTime(v); err == nil {
+			res.Updated = t
+		}
+	}
+	return res, nil
+}
+
+// Accessor produces the URL of a resource on the service. Access to it is
+// governed by the service, so any accessor options other than the default
+// are not supported.
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (_ string, err error) {
+	defer wrap(blob.OpAccessor, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return "", err
+	}
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if !conf.IsAccessorDefault() {
+		return "", fmt.Errorf("%w: accessor options", blob.ErrNotSupported)
+	}
+	_, err = c.stat(cxt, key)
+	if err != nil {
+		return "", err
+	}
+	return c.endpoint(key), nil
+}
+
+// Write streams a resource to the service. The data is uploaded as it is
+// written, using a chunked request, which completes when the writer is
+// closed.
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+	return c.write(cxt, key, conf)
+}
+
+func (c *Client) write(cxt context.Context, key string, conf blob.WriteConfig) (*writer, error) {
+	r, w := io.Pipe()
+	req, err := c.request(cxt, nethttp.MethodPut, c.endpoint(key), r)
+	if err != nil {
+		return nil, err
+	}
+	setHeaders(req.Header, conf)
+
+	done := make(chan error, 1)
+	go func() {
+		rsp, err := c.do(req)
+		if err == nil {
+			rsp.Body.Close()
+		}
+		r.CloseWithError(err) // unblock the writer if the request ended early
+		done <- err
+	}()
+
+	return &writer{PipeWriter: w, cxt: cxt, url: c.fqbp + key, done: done}, nil
+}
+
+type writer struct {
+	*io.PipeWriter
+	cxt     context.Context
+	url     string
+	done    chan error
+	aborted bool
+	closed  bool
+}
+
+// Abort fails the request by failing the stream it reads from, so the
+// service never receives the end of the upload
+func (w *writer) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	if err == nil {
+		err = blob.ErrAborted
+	}
+	w.aborted, w.closed = true, true
+	w.PipeWriter.CloseWithError(err)
+	<-w.done
+	return nil
+}
+
+func (w *writer) Close() (err error) {
+	defer wrap(blob.OpWrite, w.url, &err)
+	if w.aborted {
+		return blob.ErrAborted
+	}
+	w.closed = true
+	if err := w.cxt.Err(); err != nil {
+		w.PipeWriter.CloseWithError(err) // canceled; the upload never ends
+		<-w.done
+		return blob.ErrCanceled
+	}
+	w.PipeWriter.Close()
+	return <-w.done
+}
+
+// setHeaders describes the attributes and preconditions of a write in
+// request headers
+func setHeaders(hdr nethttp.Header, conf blob.WriteConfig) {
+	if v := conf.ContentType; v != "" {
+		hdr.Set("Content-Type", v)
+	}
+	if v := conf.ContentEncoding; v != "" {
+		hdr.Set("Content-Encoding", v)
+	}
+	if v := conf.ContentDisposition; v != "" {
+		hdr.Set("Content-Disposition", v)
+	}
+	if v := conf.ContentLanguage; v != "" {
+		hdr.Set("Content-Language", v)
+	}
+	if v := conf.CacheControl; v != "" {
+		hdr.Set("Cache-Control", v)
+	}
+	for k, v := range conf.Metadata {
+		hdr.Set(httpblob.MetaPrefix+k, v)
+	}
+	if conf.IfNotExists {
+		hdr.Set("If-None-Match", "*")
+	}
+	if v := conf.IfMatch; v != "" {
+		hdr.Set("If-Match", strconv.Quote(v))
+	}
+}
+
+// Copy copies a resource. The protocol has no means of copying a resource on
+// the service, so it is read and written back by the client.
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	return c.copy(cxt, src, dst, false, opts)
+}
+
+// Move moves a resource by copying it and then deleting the original
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	return c.copy(cxt, src, dst, true, opts)
+}
+
+func (c *Client) copy(cxt context.Context, src, dst string, move bool, opts []blob.WriteOption) error {
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	skey, err := c.path(src)
+	if err != nil {
+		return err
+	}
+	dkey, err := c.path(dst)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.stat(cxt, skey)
+	if err != nil {
+		return err
+	}
+	if move && skey == dkey {
+		return nil // nothing to do
+	}
+
+	// a copy onto itself is written like any other, so that overrides and
+	// preconditions apply; the original is read until the write replaces it
+	req, err := c.request(cxt, nethttp.MethodGet, c.endpoint(skey), nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	w, err := c.write(cxt, dkey, merge(res, conf))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rsp.Body)
+	if err != nil {
+		w.Abort(err)
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	if move {
+		return c.delete(cxt, skey, blob.WriteConfig{IfMatch: res.ETag})
+	}
+	return nil
+}
+
+// merge produces the configuration used to write a copy of a resource; the
+// attributes of the source are overridden by any set in the configuration
+func merge(res blob.Resource, conf blob.WriteConfig) blob.WriteConfig {
+	if conf.ContentType == "" {
+		conf.ContentType = res.ContentType
+	}
+	if conf.ContentEncoding == "" {
+		conf.ContentEncoding = res.ContentEncoding
+	}
+	if conf.ContentDisposition == "" {
+		conf.ContentDisposition = res.ContentDisposition
+	}
+	if conf.ContentLanguage == "" {
+		conf.ContentLanguage = res.ContentLanguage
+	}
+	if conf.CacheControl == "" {
+		conf.CacheControl = res.CacheControl
+	}
+	if conf.Metadata == nil {
+		conf.Metadata = maps.Clone(res.Metadata)
+	}
+	return conf
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDelete, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return err
+	}
+	return c.delete(cxt, key, conf)
+}
+
+func (c *Client) delete(cxt context.Context, key string, conf blob.WriteConfig) error {
+	req, err := c.request(cxt, nethttp.MethodDelete, c.endpoint(key), nil)
+	if err != nil {
+		return err
+	}
+	if v := conf.IfMatch; v != "" {
+		req.Header.Set("If-Match", strconv.Quote(v))
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	return nil
+}
+
+func (c *Client) String() string {
+	return c.fqbp
+}
+
+func unquote(v string) string {
+	if u, err := strconv.Unquote(v); err == nil {
+		return u
+	}
+	return v
+}
+
+// wrap describes an error produced by a request for a resource, classified
+// by kind
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, kind(*err), *err)
+}
+
+// kind classifies an error. Errors which describe responses are classified
+// by errorFrom; those which remain are failures to reach the service at all.
+// Only a timeout, or a connection which was refused or reset, means that the
+// service is unavailable; others, such as a host which can't be resolved or
+// a failed TLS handshake, are left unclassified.
+func kind(err error) error {
+	if k := blob.Kind(err); k != nil {
+		return k
+	}
+	var nerr net.Error
+	switch {
+	case errors.As(err, &nerr) && nerr.Timeout(),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNABORTED):
+		return blob.ErrUnavailable
+	}
+	return nil
+}
+
+// errorFrom produces an error which describes an unsuccessful response,
+// mapped to the corresponding blob error where there is one
+func errorFrom(rsp *nethttp.Response) error {
+	d, _ := io.ReadAll(io.LimitReader(rsp.Body, 1<<10))
+	msg := strings.TrimSpace(string(d))
+	if msg == "" {
+		msg = rsp.Status
+	}
+	var base error
+	switch rsp.StatusCode {
+	case nethttp.StatusUnauthorized, nethttp.StatusForbidden:
+		base = blob.ErrPermission
+	case nethttp.StatusNotFound:
+		base = blob.ErrNotFound
+	case nethttp.StatusConflict:
+		base = blob.ErrAlreadyExists
+	case nethttp.StatusPreconditionFailed:
+		base = blob.ErrPreconditionFailed
+	case nethttp.StatusRequestedRangeNotSatisfiable:
+		base = blob.ErrInvalidRange
+	case nethttp.StatusNotImplemented:
+		base = blob.ErrNotSupported
+	case nethttp.StatusTooManyRequests, nethttp.StatusBadGateway, nethttp.StatusServiceUnavailable, nethttp.StatusGatewayTimeout:
+		base = blob.ErrUnavailable
+	case nethttp.StatusBadRequest:
+		if strings.Contains(msg, blob.ErrInvalidToken.Error()) {
+			base = blob.ErrInvalidToken
+		} else {
+			base = blob.ErrInvalidURL
+		}
+	default:
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%w: %s", base, msg)
+}
@@ -0,0 +1,347 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/httpblob"
+	"github.com/bww/go-blob/v1/impl/internal/conformance"
+	"github.com/bww/go-blob/v1/impl/mem"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPCRUD(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://http")
+	if !assert.NoError(t, err) {
+		return
+	}
+	svc := httptest.NewServer(httpblob.NewWithConfig(backend, httpblob.Config{
+		Prefix: "/blobs",
+		Authorize: func(req *nethttp.Request, key string) error {
+			if req.Header.Get("Authorization") != "Bearer secret" {
+				return httpblob.ErrUnauthorized
+			}
+			return nil
+		},
+	}))
+	defer svc.Close()
+
+	base := svc.URL + "/blobs"
+	store, err := NewWithConfig(cxt, base, Config{
+		Header: nethttp.Header{"Authorization": {"Bearer secret"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, store.Init(cxt))
+
+	d1 := `Hello, this is the data.`
+	d2 := `Hello, this is the updated data.`
+
+	// write a resource, in pieces
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, e := range []string{d1[:7], d1[7:]} {
+		_, err = w.Write([]byte(e))
+		assert.NoError(t, err)
+	}
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// this is the same resource, using the URL resource indicator
+	dsn = base + "/file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte(d2))
+	assert.NoError(t, err)
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// the result must be the second version, on the service too
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err := store.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, d2, string(d))
+		assert.NoError(t, r.Close())
+	}
+	r, err = backend.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, d2, string(d))
+	}
+
+	// read part of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err = store.Read(cxt, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "this", string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read the end of the resource
+	r, err = store.Read(cxt, dsn, blob.WithOffset(-5))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "data.", string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read beyond the end of the resource
+	_, err = store.Read(cxt, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// write a resource with attributes
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn,
+		blob.WithContentType("text/plain"),
+		blob.WithCacheControl("no-cache"),
+		blob.WithMetadata(map[string]string{"owner": "tests"}),
+	)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// describe it
+	m1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, base+"/meta1", m1.URL)
+		assert.Equal(t, "text/plain", m1.ContentType)
+		assert.Equal(t, "no-cache", m1.CacheControl)
+		assert.Equal(t, map[string]string{"owner": "tests"}, m1.Metadata)
+		assert.Equal(t, int64(len(d1)), m1.Size)
+		assert.NotEmpty(t, m1.ETag)
+		assert.False(t, m1.Updated.IsZero())
+	}
+
+	// copies preserve the attributes that aren't overridden
+	err = store.Copy(cxt, dsn, "copy/meta2", blob.WithContentType("application/json"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, "copy/meta2")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "no-cache", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// including a copy onto itself, which is still subject to preconditions
+	dsn = "copy/meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, dsn, blob.WithCacheControl("max-age=60"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "max-age=60", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+	err = store.Copy(cxt, dsn, dsn, blob.WithIfNotExists())
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// move the copy somewhere else
+	dsn = "copy/meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Move(cxt, dsn, "dir/meta3")
+	if assert.NoError(t, err) {
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+		m3, err := store.Stat(cxt, "dir/meta3")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m3.ContentType)
+		}
+	}
+
+	// list everything in the store
+	tree := make(map[string]struct{})
+	res, err := siter.CollectErr(store.List(cxt, ""))
+	if assert.NoError(t, err) {
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			tree[rc.URL] = struct{}{}
+		}
+	}
+	assert.Equal(t, map[string]struct{}{
+		base + "/file1":     {},
+		base + "/meta1":     {},
+		base + "/dir/meta3": {},
+	}, tree)
+
+	// page through the same listing, a few entries at a time
+	var paged []string
+	for token := ""; ; {
+		iter, err := store.List(cxt, "", blob.WithPageSize(2), blob.WithPageToken(token))
+		if !assert.NoError(t, err) {
+			break
+		}
+		res, err := siter.CollectErr(iter, nil)
+		if !assert.NoError(t, err) || !assert.LessOrEqual(t, len(res), 2) {
+			break
+		}
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			paged = append(paged, rc.URL)
+		}
+		if token = blob.NextPageToken(iter); token == "" {
+			break
+		}
+	}
+	if assert.Len(t, paged, len(tree)) {
+		for _, e := range paged {
+			assert.Contains(t, tree, e)
+		}
+	}
+	_, err = store.List(cxt, "", blob.WithPageToken("not a token"))
+	assert.ErrorIs(t, err, blob.ErrInvalidToken)
+
+	// list only the immediate children of the prefix
+	res, err = siter.CollectErr(store.List(cxt, "", blob.WithDelimiter("/")))
+	if assert.NoError(t, err) {
+		children := make(map[string]bool)
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			children[rc.URL] = rc.IsPrefix
+		}
+		assert.Equal(t, map[string]bool{
+			base + "/file1": false,
+			base + "/meta1": false,
+			base + "/dir/":  true,
+		}, children)
+	}
+
+	// an aborted write stores nothing, even after being closed, nor does a
+	// write whose context ends before it is closed
+	conformance.Abort(t, cxt, store, "aborted1")
+
+	// conditionally create a resource, only once
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Close())
+	}
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, w.Close(), blob.ErrPreconditionFailed)
+	}
+
+	// a stale version can't be used to delete it, but the current one can
+	dsn = "cond1"
+	fmt.Printf("~~ %s\n", dsn)
+	c1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		err = store.Delete(cxt, dsn, blob.WithIfMatch("not-the-version"))
+		assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+		err = store.Delete(cxt, dsn, blob.WithIfMatch(c1.ETag))
+		assert.NoError(t, err)
+	}
+
+	// obtain an accessor for the resource, which is its URL on the service
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	a1, err := store.Accessor(cxt, dsn)
+	assert.NoError(t, err)
+	assert.Equal(t, base+"/file1", a1)
+	_, err = store.Accessor(cxt, dsn, blob.WithExpiry(time.Minute))
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
+	// delete resources in bulk, then everything under a prefix
+	for _, e := range []string{"bulk/a", "bulk/b", "bulk/c/d", "bulk/c/e"} {
+		w, err = store.Write(cxt, e)
+		if assert.NoError(t, err) {
+			_, err = w.Write([]byte(d1))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+		}
+	}
+	err = blob.DeleteMany(cxt, store, []string{"bulk/a", "bulk/c/d", "bulk/missing"}, blob.WithConcurrency(2))
+	assert.NoError(t, err)
+	_, err = store.Stat(cxt, "bulk/a")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "bulk/b")
+	assert.NoError(t, err)
+	err = blob.DeletePrefix(cxt, store, "bulk/")
+	assert.NoError(t, err)
+	for _, e := range []string{"bulk/b", "bulk/c/e"} {
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+	// delete our resources
+	for _, e := range []string{"file1", "meta1", "dir/meta3"} {
+		fmt.Printf("~~ %s\n", e)
+		assert.NoError(t, store.Delete(cxt, e))
+	}
+
+	// they shouldn't exist now
+	dsn = "file1"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.ErrorIs(t, store.Delete(cxt, dsn), blob.ErrNotFound)
+	_, err = store.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// a client without credentials can't do anything
+	anon, err := New(cxt, base)
+	if assert.NoError(t, err) {
+		_, err = anon.Stat(cxt, "meta1")
+		assert.ErrorIs(t, err, blob.ErrPermission)
+		assert.NotErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	// a client for a different service can't operate on this one
+	dsn = "https://example.com/file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrInvalidURL)
+
+	// a service which refuses connections is unavailable
+	closed := httptest.NewServer(nethttp.NotFoundHandler())
+	closed.Close()
+	down, err := New(cxt, closed.URL)
+	if assert.NoError(t, err) {
+		_, err = down.Stat(cxt, "file1")
+		assert.ErrorIs(t, err, blob.ErrUnavailable)
+	}
+
+	// but one which can't be reached securely is misconfigured
+	insecure, err := New(cxt, "https://"+strings.TrimPrefix(svc.URL, "http://")+"/blobs")
+	if assert.NoError(t, err) {
+		_, err = insecure.Stat(cxt, "file1")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, blob.ErrUnavailable)
+	}
+}
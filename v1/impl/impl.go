@@ -6,27 +6,34 @@ import (
 	"net/url"
 
 	"github.com/bww/go-blob/v1"
-	"github.com/bww/go-blob/v1/impl/fs"
-	"github.com/bww/go-blob/v1/impl/gcs"
+
+	// every backend registers itself when it is initialized
+	_ "github.com/bww/go-blob/v1/impl/fs"
+	_ "github.com/bww/go-blob/v1/impl/gcs"
+	_ "github.com/bww/go-blob/v1/impl/http"
+	_ "github.com/bww/go-blob/v1/impl/mem"
+	_ "github.com/bww/go-blob/v1/impl/s3"
 )
 
-// New creates a blob service for the specified DSN. If no such backend is
-// supported, an error is returned. Currently, the following backends are
-// supported:
+// New creates a blob service for the specified DSN using the backend that
+// is registered for its scheme. If no such backend is registered, an error
+// is returned. The following backends are always available:
 //
 // - `file://<root>` The local filesystem
 // - `gcs://bucket` Google Cloud Storage
+// - `http://host/path`, `https://host/path` A remote service served by httpblob
+// - `mem://name` An in-memory store, shared by every client with the same name
+// - `s3://bucket/prefix` Amazon S3 and S3-compatible services
+//
+// Others may be added with Register.
 func New(cxt context.Context, dsn string) (blob.Client, error) {
 	u, err := url.Parse(dsn)
 	if err != nil {
 		return nil, err
 	}
-	switch u.Scheme {
-	case fs.Scheme:
-		return fs.New(cxt, dsn)
-	case gcs.Scheme:
-		return gcs.New(cxt, dsn)
-	default:
+	f, ok := blob.Lookup(u.Scheme)
+	if !ok {
 		return nil, fmt.Errorf("%w: %s", blob.ErrNotSupported, dsn)
 	}
+	return f(cxt, dsn)
 }
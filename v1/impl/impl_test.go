@@ -2,9 +2,11 @@ package impl
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,6 +17,46 @@ func TestImpl(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = New(cxt, "file:///tmp/path")
 	assert.NoError(t, err)
+	_, err = New(cxt, "mem://test")
+	assert.NoError(t, err)
+	_, err = New(cxt, "s3://test/prefix")
+	assert.NoError(t, err)
+	_, err = New(cxt, "https://example.com/blobs")
+	assert.NoError(t, err)
 	_, err = New(cxt, "unsupported://doesnt-exist")
 	assert.ErrorIs(t, err, blob.ErrNotSupported)
 }
+
+func TestRegister(t *testing.T) {
+	cxt := context.Background()
+	assert.Subset(t, Schemes(), []string{"file", "gcs", "http", "https", "mem", "s3"})
+
+	// register a new backend, which just uses another under the hood; the
+	// registry is global, so it may already exist if tests are repeated
+	if _, ok := Lookup("custom"); !ok {
+		Register("custom", func(cxt context.Context, dsn string) (blob.Client, error) {
+			return mem.New(cxt, "mem://custom")
+		})
+	}
+	assert.Contains(t, Schemes(), "custom")
+	_, ok := Lookup("custom")
+	assert.True(t, ok)
+	c, err := New(cxt, "custom://whatever")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mem://custom/", fmt.Sprint(c))
+	}
+
+	// a scheme can't be registered twice
+	assert.Panics(t, func() {
+		Register("custom", func(cxt context.Context, dsn string) (blob.Client, error) {
+			return nil, nil
+		})
+	})
+
+	// nor can a nil factory
+	assert.Panics(t, func() {
+		Register("nothing", nil)
+	})
+	_, ok = Lookup("nothing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,42 @@
+// Package conformance checks behavior which every backend must share.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// Abort checks that a write which is aborted, or whose context ends before
+// it is closed, stores nothing, even after it is closed. A writer's Close
+// doesn't return until its upload has ended, so once it has returned the
+// resource must not exist.
+func Abort(t *testing.T, cxt context.Context, store blob.Client, dsn string) {
+	d1 := "Hello, this is the data."
+
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	wcxt, wcancel := context.WithCancel(cxt)
+	defer wcancel()
+	w, err = store.Write(wcxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		wcancel()
+		assert.ErrorIs(t, w.Close(), blob.ErrCanceled)
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+}
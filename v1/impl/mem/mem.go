@@ -0,0 +1,470 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+
+	siter "github.com/bww/go-iterator/v1"
+)
+
+const (
+	Scheme       = "mem"
+	schemePrefix = "mem://"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Stores are shared by every client that refers to them by the same name
+var (
+	storesLock sync.Mutex
+	stores     = make(map[string]*store)
+)
+
+type object struct {
+	data []byte
+	attr blob.Resource // everything but the URL
+}
+
+type store struct {
+	sync.RWMutex
+	objects map[string]object
+	gen     int64
+}
+
+func named(name string) *store {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+	s, ok := stores[name]
+	if !ok {
+		s = &store{objects: make(map[string]object)}
+		stores[name] = s
+	}
+	return s
+}
+
+type Config struct {
+	// Deprecated: Logger is ignored; wrap the client with the logging package
+	// to log its operations.
+	Logger *slog.Logger
+}
+
+func init() {
+	blob.Register(Scheme, blob.NewFactory(New))
+}
+
+// Client is a thread-safe, in-memory blob client. It is principally intended
+// for testing. Every client created with the same name shares its storage.
+type Client struct {
+	store *store
+	fqbp  string // fully-qualified prefix
+}
+
+func New(cxt context.Context, rc string) (*Client, error) {
+	return NewWithConfig(cxt, rc, Config{})
+}
+
+func NewWithConfig(cxt context.Context, rc string, conf Config) (*Client, error) {
+	u, err := url.Parse(rc)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: no store name in %q", blob.ErrInvalidURL, rc)
+	}
+	return &Client{
+		store: named(u.Host),
+		fqbp:  schemePrefix + u.Host + "/",
+	}, nil
+}
+
+func (c *Client) path(rc string) (string, error) {
+	if !strings.HasPrefix(rc, schemePrefix) {
+		return strings.TrimPrefix(rc, "/"), nil // just a path
+	}
+	if !strings.HasPrefix(rc, c.fqbp) {
+		return "", fmt.Errorf("%w: expected prefix %q in %q", blob.ErrInvalidURL, c.fqbp, rc)
+	}
+	return rc[len(c.fqbp):], nil
+}
+
+// wrap describes an error produced by an operation on a resource. The
+// store's errors wrap the sentinels, so blob.Kind classifies them.
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, nil, *err)
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return nil // nothing to do
+}
+
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store.RLock()
+	obj, ok := c.store.objects[key]
+	c.store.RUnlock()
+	if !ok {
+		return nil, blob.ErrNotFound
+	}
+
+	// object data is never modified once stored, so we can read it freely
+	data := obj.data
+	size := int64(len(data))
+	offset := conf.Offset
+	if offset > size {
+		return nil, fmt.Errorf("%w: offset %d exceeds size %d", blob.ErrInvalidRange, offset, size)
+	} else if offset < 0 {
+		offset = max(size+offset, 0)
+	}
+	data = data[offset:]
+	if l := conf.Length; l > 0 && l < int64(len(data)) {
+		data = data[:l]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (_ siter.Iterator[blob.Resource], err error) {
+	defer wrap(blob.OpList, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	prefix, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store.RLock()
+	defer c.store.RUnlock()
+	var res []blob.Resource
+	seen := make(map[string]struct{})
+	for key, obj := range c.store.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if d := conf.Delimiter; d != "" {
+			if x := strings.Index(key[len(prefix):], d); x >= 0 {
+				p := key[:len(prefix)+x+len(d)]
+				if _, ok := seen[p]; !ok {
+					seen[p] = struct{}{}
+					res = append(res, blob.Resource{URL: c.fqbp + p, IsPrefix: true})
+				}
+				continue
+			}
+		}
+		res = append(res, c.resource(key, obj))
+	}
+	slices.SortFunc(res, func(a, b blob.Resource) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	// the page token is the last URL produced by the previous page
+	if conf.PageToken != "" {
+		last, err := base64.RawURLEncoding.DecodeString(conf.PageToken)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", blob.ErrInvalidToken, err)
+		}
+		x, _ := slices.BinarySearchFunc(res, string(last), func(e blob.Resource, t string) int {
+			return strings.Compare(e.URL, t)
+		})
+		if x < len(res) && res[x].URL == string(last) {
+			x++
+		}
+		res = res[x:]
+	}
+	var next string
+	if n := conf.PageSize; n > 0 && len(res) > n {
+		res = res[:n]
+		next = base64.RawURLEncoding.EncodeToString([]byte(res[n-1].URL))
+	}
+
+	page := blob.NewPageIterator(siter.NewWithSlice(cxt, res))
+	page.SetNextPageToken(next)
+	return page, nil
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (_ blob.Resource, err error) {
+	defer wrap(blob.OpStat, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	c.store.RLock()
+	defer c.store.RUnlock()
+	obj, ok := c.store.objects[key]
+	if !ok {
+		return blob.Resource{}, blob.ErrNotFound
+	}
+	return c.resource(key, obj), nil
+}
+
+func (c *Client) resource(key string, obj object) blob.Resource {
+	rc := obj.attr
+	rc.URL = c.fqbp + key
+	rc.Metadata = maps.Clone(rc.Metadata)
+	return rc
+}
+
+// Accessor produces the URL of a resource, which is only meaningful to other
+// clients of the same store. Such a URL can't expire or be used for anything
+// but reading, so any accessor options other than the default are not
+// supported.
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (_ string, err error) {
+	defer wrap(blob.OpAccessor, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return "", err
+	}
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	if !conf.IsAccessorDefault() {
+		return "", fmt.Errorf("%w: accessor options", blob.ErrNotSupported)
+	}
+	c.store.RLock()
+	defer c.store.RUnlock()
+	if _, ok := c.store.objects[key]; !ok {
+		return "", blob.ErrNotFound
+	}
+	return c.fqbp + key, nil
+}
+
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{
+		cxt:   cxt,
+		store: c.store,
+		key:   key,
+		url:   c.fqbp + key,
+		conf:  conf,
+	}, nil
+}
+
+// writer buffers data which is stored when it is closed
+type writer struct {
+	bytes.Buffer
+	cxt     context.Context
+	store   *store
+	key     string
+	url     string
+	conf    blob.WriteConfig
+	aborted bool
+	closed  bool
+}
+
+func (w *writer) Abort(err error) error {
+	if !w.closed {
+		w.aborted, w.closed = true, true
+		w.Reset()
+	}
+	return nil
+}
+
+func (w *writer) Close() (err error) {
+	defer wrap(blob.OpWrite, w.url, &err)
+	if w.aborted {
+		return blob.ErrAborted
+	}
+	w.closed = true
+	if err := w.cxt.Err(); err != nil {
+		return err // canceled; nothing is stored
+	}
+	data := w.Bytes()
+	w.store.Lock()
+	defer w.store.Unlock()
+	err = w.store.check(w.key, w.conf)
+	if err != nil {
+		return err
+	}
+	w.store.put(w.key, data, apply(blob.Resource{
+		ContentType: mime.TypeByExtension(path.Ext(w.key)),
+	}, w.conf))
+	return nil
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	return c.copy(cxt, src, dst, false, opts)
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	return c.copy(cxt, src, dst, true, opts)
+}
+
+func (c *Client) copy(cxt context.Context, src, dst string, move bool, opts []blob.WriteOption) error {
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	skey, err := c.path(src)
+	if err != nil {
+		return err
+	}
+	dkey, err := c.path(dst)
+	if err != nil {
+		return err
+	}
+
+	c.store.Lock()
+	defer c.store.Unlock()
+	obj, ok := c.store.objects[skey]
+	if !ok {
+		return blob.ErrNotFound
+	}
+	if move && skey == dkey {
+		return nil // nothing to do
+	}
+	err = c.store.check(dkey, conf)
+	if err != nil {
+		return err
+	}
+	c.store.put(dkey, obj.data, apply(obj.attr, conf))
+	if move {
+		delete(c.store.objects, skey)
+	}
+	return nil
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDelete, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return err
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	if _, ok := c.store.objects[key]; !ok {
+		return blob.ErrNotFound
+	}
+	err = c.store.check(key, conf)
+	if err != nil {
+		return err
+	}
+	delete(c.store.objects, key)
+	return nil
+}
+
+// DeleteMany deletes resources in a single operation on the store.
+// Resources which do not exist are ignored.
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	errs := make(map[string]error)
+	c.store.Lock()
+	defer c.store.Unlock()
+	for _, u := range urls {
+		key, err := c.path(u)
+		if err != nil {
+			errs[u] = blob.NewError(blob.OpDelete, u, nil, err)
+			continue
+		}
+		delete(c.store.objects, key)
+	}
+	if len(errs) > 0 {
+		return &blob.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// DeletePrefix deletes every resource under a prefix in a single operation
+// on the store
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeletePrefix, prefix, &err)
+	key, err := c.path(prefix)
+	if err != nil {
+		return err
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	for k := range c.store.objects {
+		if strings.HasPrefix(k, key) {
+			delete(c.store.objects, k)
+		}
+	}
+	return nil
+}
+
+func (c *Client) String() string {
+	return c.fqbp
+}
+
+// check determines whether the object with the specified key satisfies the
+// preconditions described by a configuration. The store must be locked.
+func (s *store) check(key string, conf blob.WriteConfig) error {
+	obj, ok := s.objects[key]
+	if conf.IfNotExists && ok {
+		return blob.ErrPreconditionFailed
+	}
+	if conf.IfMatch != "" {
+		if !ok {
+			return blob.ErrPreconditionFailed
+		}
+		if conf.IfMatch != obj.attr.ETag && conf.IfMatch != strconv.FormatInt(obj.attr.Generation, 10) {
+			return blob.ErrPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// put stores an object as a new generation. The store must be locked.
+func (s *store) put(key string, data []byte, attr blob.Resource) {
+	s.gen++
+	sum := md5.Sum(data)
+	now := time.Now()
+	attr.Size = int64(len(data))
+	attr.Created = now
+	attr.Updated = now
+	attr.ETag = hex.EncodeToString(sum[:])
+	attr.Generation = s.gen
+	attr.MD5 = sum[:]
+	attr.CRC32C = crc32.Checksum(data, castagnoli)
+	attr.Metadata = maps.Clone(attr.Metadata)
+	s.objects[key] = object{
+		data: bytes.Clone(data),
+		attr: attr,
+	}
+}
+
+// apply produces a copy of the provided attributes, overridden by any that
+// are set in a configuration
+func apply(attr blob.Resource, conf blob.WriteConfig) blob.Resource {
+	if v := conf.ContentType; v != "" {
+		attr.ContentType = v
+	}
+	if v := conf.ContentEncoding; v != "" {
+		attr.ContentEncoding = v
+	}
+	if v := conf.ContentDisposition; v != "" {
+		attr.ContentDisposition = v
+	}
+	if v := conf.ContentLanguage; v != "" {
+		attr.ContentLanguage = v
+	}
+	if v := conf.CacheControl; v != "" {
+		attr.CacheControl = v
+	}
+	if v := conf.Metadata; v != nil {
+		attr.Metadata = v
+	}
+	return attr
+}
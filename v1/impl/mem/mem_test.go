@@ -0,0 +1,312 @@
+package mem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/internal/conformance"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemCRUD(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	base := "mem://crud"
+	store, err := New(cxt, base)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// another client with the same name shares storage
+	other, err := New(cxt, base)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	d1 := `Hello, this is the data.`
+	d2 := `Hello, this is the updated data.`
+
+	// write a resource
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err := w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.Equal(t, len(d1), n)
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// this is the same resource, using the URL resource indicator
+	dsn = base + "/file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err = w.Write([]byte(d2)) // write second version
+	assert.NoError(t, err)
+	assert.Equal(t, len(d2), n)
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// the result must be the second version, from either client
+	for _, c := range []blob.Client{store, other} {
+		dsn = "file1"
+		fmt.Printf("<= %s\n", dsn)
+		r, err := c.Read(cxt, dsn)
+		if assert.NoError(t, err) {
+			d, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, d2, string(d))
+			assert.NoError(t, r.Close())
+		}
+	}
+
+	// read part of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err := store.Read(cxt, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "this", string(d))
+	}
+
+	// read the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err = store.Read(cxt, dsn, blob.WithOffset(-5))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "data.", string(d))
+	}
+
+	// read beyond the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// describe the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	s1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, base+"/file1", s1.URL)
+		assert.Equal(t, int64(len(d2)), s1.Size)
+		assert.NotEmpty(t, s1.ETag)
+		assert.NotEmpty(t, s1.MD5)
+		assert.NotZero(t, s1.CRC32C)
+	}
+
+	// write a resource with attributes
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn,
+		blob.WithContentType("text/plain"),
+		blob.WithCacheControl("no-cache"),
+		blob.WithMetadata(map[string]string{"owner": "tests"}),
+	)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// copies preserve the attributes that aren't overridden
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "copy/meta2", blob.WithContentType("application/json"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, "copy/meta2")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "no-cache", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// including a copy onto itself, which is still subject to preconditions
+	dsn = "copy/meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, dsn, blob.WithCacheControl("max-age=60"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "max-age=60", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+	err = store.Copy(cxt, dsn, dsn, blob.WithIfNotExists())
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// move the copy somewhere else
+	dsn = "copy/meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Move(cxt, dsn, "dir/meta3")
+	if assert.NoError(t, err) {
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+		m3, err := store.Stat(cxt, "dir/meta3")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m3.ContentType)
+		}
+	}
+
+	// list everything in the store
+	tree := make(map[string]struct{})
+	iter, err := store.List(cxt, base+"/")
+	if assert.NoError(t, err) {
+		for {
+			rc, err := iter.Next()
+			if siter.IsFinished(err) {
+				break
+			} else if !assert.NoError(t, err) {
+				break
+			}
+			fmt.Printf("<... %v\n", rc.URL)
+			tree[rc.URL] = struct{}{}
+		}
+	}
+	assert.Equal(t, map[string]struct{}{
+		base + "/file1":     {},
+		base + "/meta1":     {},
+		base + "/dir/meta3": {},
+	}, tree)
+
+	// page through the same listing, a few entries at a time
+	var paged []string
+	for token := ""; ; {
+		iter, err := store.List(cxt, base+"/", blob.WithPageSize(2), blob.WithPageToken(token))
+		if !assert.NoError(t, err) {
+			break
+		}
+		res, err := siter.CollectErr(iter, nil)
+		if !assert.NoError(t, err) || !assert.LessOrEqual(t, len(res), 2) {
+			break
+		}
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			paged = append(paged, rc.URL)
+		}
+		if token = blob.NextPageToken(iter); token == "" {
+			break
+		}
+	}
+	if assert.Len(t, paged, len(tree)) {
+		for _, e := range paged {
+			assert.Contains(t, tree, e)
+		}
+	}
+	_, err = store.List(cxt, base+"/", blob.WithPageToken("not a token"))
+	assert.ErrorIs(t, err, blob.ErrInvalidToken)
+
+	// list only the immediate children of the prefix
+	res, err := siter.CollectErr(store.List(cxt, "", blob.WithDelimiter("/")))
+	if assert.NoError(t, err) {
+		children := make(map[string]bool)
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			children[rc.URL] = rc.IsPrefix
+		}
+		assert.Equal(t, map[string]bool{
+			base + "/file1": false,
+			base + "/meta1": false,
+			base + "/dir/":  true,
+		}, children)
+	}
+
+	// an aborted write stores nothing, even after being closed, nor does a
+	// write whose context ends before it is closed
+	conformance.Abort(t, cxt, store, "aborted1")
+
+	// conditionally create a resource, only once
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Close())
+	}
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, w.Close(), blob.ErrPreconditionFailed)
+	}
+
+	// a stale version can't be used to delete it, but the current one can
+	dsn = "cond1"
+	fmt.Printf("~~ %s\n", dsn)
+	c1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		err = store.Delete(cxt, dsn, blob.WithIfMatch("not-the-version"))
+		assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+		err = store.Delete(cxt, dsn, blob.WithIfMatch(strconv.FormatInt(c1.Generation, 10)))
+		assert.NoError(t, err)
+	}
+
+	// obtain an accessor for the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	a1, err := store.Accessor(cxt, dsn)
+	assert.NoError(t, err)
+	assert.Equal(t, base+"/file1", a1)
+	_, err = store.Accessor(cxt, dsn, blob.WithResponseContentDisposition("attachment"))
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
+	// delete resources in bulk, then everything under a prefix
+	for _, e := range []string{"bulk/a", "bulk/b", "bulk/c/d", "bulk/c/e"} {
+		w, err = store.Write(cxt, e)
+		if assert.NoError(t, err) {
+			_, err = w.Write([]byte(d1))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+		}
+	}
+	err = blob.DeleteMany(cxt, store, []string{"bulk/a", "bulk/c/d", "bulk/missing"}, blob.WithConcurrency(2))
+	assert.NoError(t, err)
+	_, err = store.Stat(cxt, "bulk/a")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "bulk/b")
+	assert.NoError(t, err)
+	err = blob.DeletePrefix(cxt, store, "bulk/")
+	assert.NoError(t, err)
+	for _, e := range []string{"bulk/b", "bulk/c/e"} {
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+	// delete our resources
+	for _, e := range []string{"file1", "meta1", "dir/meta3"} {
+		fmt.Printf("~~ %s\n", e)
+		assert.NoError(t, store.Delete(cxt, e))
+	}
+
+	// they shouldn't exist now, for either client
+	dsn = "file1"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.ErrorIs(t, store.Delete(cxt, dsn), blob.ErrNotFound)
+	_, err = other.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = other.Accessor(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// a client for a different store can't operate on this one
+	dsn = "mem://other/file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrInvalidURL)
+}
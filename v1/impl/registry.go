@@ -0,0 +1,27 @@
+package impl
+
+import (
+	"github.com/bww/go-blob/v1"
+)
+
+// The registry is kept by package blob, so that backends can register
+// themselves without importing this package, which imports them.
+
+// Factory creates a blob client for a DSN
+type Factory = blob.Factory
+
+// Register makes a backend available for DSNs with the specified scheme, as
+// with blob.Register
+func Register(scheme string, factory Factory) {
+	blob.Register(scheme, factory)
+}
+
+// Lookup obtains the factory registered for the specified scheme, if any
+func Lookup(scheme string) (Factory, bool) {
+	return blob.Lookup(scheme)
+}
+
+// Schemes lists every scheme for which a backend is registered, in order
+func Schemes() []string {
+	return blob.Schemes()
+}
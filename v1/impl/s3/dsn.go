@@ -0,0 +1,57 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bww/go-blob/v1"
+)
+
+// DSN describes an S3 bucket and the service which hosts it, in the form:
+//
+//	s3://bucket[/prefix][?endpoint=<url>&region=<region>&path_style=<bool>]
+//
+// The endpoint is only required for S3-compatible services (MinIO, Ceph
+// RGW, etc). Credentials are never part of the DSN; they are obtained from
+// the environment in the usual way for AWS clients.
+type DSN struct {
+	Bucket    string
+	Prefix    string
+	Endpoint  string
+	Region    string
+	PathStyle bool
+}
+
+func ParseDSN(dsn string) (DSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return DSN{}, err
+	}
+	if u.Host == "" {
+		return DSN{}, fmt.Errorf("%w: no bucket in %q", blob.ErrInvalidURL, dsn)
+	}
+
+	var prefix string
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		prefix = p + "/"
+	}
+
+	q := u.Query()
+	var pathStyle bool
+	if v := q.Get("path_style"); v != "" {
+		pathStyle, err = strconv.ParseBool(v)
+		if err != nil {
+			return DSN{}, fmt.Errorf("%w: invalid path_style %q in %q", blob.ErrInvalidURL, v, dsn)
+		}
+	}
+
+	return DSN{
+		Bucket:    u.Host,
+		Prefix:    prefix,
+		Endpoint:  q.Get("endpoint"),
+		Region:    q.Get("region"),
+		PathStyle: pathStyle,
+	}, nil
+}
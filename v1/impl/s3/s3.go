@@ -0,0 +1,833 @@
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/bww/go-util/v1/contexts"
+)
+
+const pagelen = 64
+
+const (
+	Scheme       = "s3"
+	schemePrefix = "s3://"
+)
+
+const defaultRegion = "us-east-1"
+
+var ErrInvalidBucket = errors.New("Invalid bucket")
+
+type Config struct {
+	// Deprecated: Logger is ignored; wrap the client with the logging package
+	// to log its operations.
+	Logger *slog.Logger
+}
+
+func init() {
+	blob.Register(Scheme, blob.NewFactory(New))
+}
+
+type Client struct {
+	client  *awss3.Client
+	presign *awss3.PresignClient
+	bucket  string
+	prefix  string
+	region  string
+	fqbp    string // fully-qualified bucket prefix
+}
+
+func New(cxt context.Context, rc string) (*Client, error) {
+	return NewWithConfig(cxt, rc, Config{})
+}
+
+func NewWithConfig(cxt context.Context, rc string, conf Config) (*Client, error) {
+	dsn, err := ParseDSN(rc)
+	if err != nil {
+		return nil, err
+	}
+	awsconf, err := config.LoadDefaultConfig(cxt)
+	if err != nil {
+		return nil, err
+	}
+	if dsn.Region != "" {
+		awsconf.Region = dsn.Region
+	} else if awsconf.Region == "" {
+		awsconf.Region = defaultRegion
+	}
+	client := awss3.NewFromConfig(awsconf, func(o *awss3.Options) {
+		if dsn.Endpoint != "" {
+			o.BaseEndpoint = aws.String(dsn.Endpoint)
+		}
+		o.UsePathStyle = dsn.PathStyle
+		// S3-compatible services often don't support the checksums that are
+		// otherwise sent by default, so we only send them when required
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	})
+	return &Client{
+		client:  client,
+		presign: awss3.NewPresignClient(client),
+		bucket:  dsn.Bucket,
+		prefix:  dsn.Prefix,
+		region:  awsconf.Region,
+		fqbp:    schemePrefix + dsn.Bucket + "/" + dsn.Prefix,
+	}, nil
+}
+
+// path produces the object key for a resource, which may be either a path
+// relative to the client prefix or a fully-qualified URL
+func (c *Client) path(rc string) (string, error) {
+	if !strings.HasPrefix(rc, schemePrefix) {
+		return c.prefix + strings.TrimPrefix(rc, "/"), nil // just a path
+	}
+	if !strings.HasPrefix(rc, c.fqbp) {
+		return "", fmt.Errorf("%w: expected prefix %q in %q", ErrInvalidBucket, c.fqbp, rc)
+	}
+	return c.prefix + rc[len(c.fqbp):], nil
+}
+
+// url produces the fully-qualified URL of an object key
+func (c *Client) url(key string) string {
+	return schemePrefix + c.bucket + "/" + key
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpInit, c.String(), &err)
+	_, err = c.client.HeadBucket(cxt, &awss3.HeadBucketInput{
+		Bucket: aws.String(c.bucket),
+	})
+	if err == nil {
+		return nil // already exists
+	} else if !isStatus(err, http.StatusNotFound) {
+		return err // only not-found is acceptable
+	}
+	input := &awss3.CreateBucketInput{
+		Bucket: aws.String(c.bucket),
+	}
+	if c.region != defaultRegion { // the default region must not be specified
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(c.region),
+		}
+	}
+	_, err = c.client.CreateBucket(cxt, input)
+	return err
+}
+
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (_ io.ReadCloser, err error) {
+	defer wrap(blob.OpRead, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+	if v := byteRange(conf); v != "" {
+		input.Range = aws.String(v)
+	}
+	res, err := c.client.GetObject(cxt, input)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if conf.Offset < 0 && conf.Length > 0 { // a suffix range can't also be limited
+		return rangeReader{io.LimitReader(res.Body, conf.Length), res.Body}, nil
+	}
+	return res.Body, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// byteRange produces the HTTP range described by a configuration, if any
+func byteRange(conf blob.ReadConfig) string {
+	switch {
+	case conf.Offset < 0: // relative to the end
+		return fmt.Sprintf("bytes=%d", conf.Offset)
+	case conf.Length > 0:
+		return fmt.Sprintf("bytes=%d-%d", conf.Offset, conf.Offset+conf.Length-1)
+	case conf.Offset > 0:
+		return fmt.Sprintf("bytes=%d-", conf.Offset)
+	default:
+		return ""
+	}
+}
+
+// List iterates over the objects under a prefix. S3 listings do not include
+// content types or user metadata; use Stat to obtain them. Objects are never
+// modified in place, so their creation and modification times are the same.
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (_ siter.Iterator[blob.Resource], err error) {
+	defer wrap(blob.OpList, rc, &err)
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	prefix, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &awss3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if conf.Delimiter != "" {
+		input.Delimiter = aws.String(conf.Delimiter)
+	}
+	if conf.PageToken != "" {
+		input.ContinuationToken = aws.String(conf.PageToken)
+	}
+	iter := siter.NewWithContext(cxt, make(chan siter.Result[blob.Resource], pagelen))
+	page := blob.NewPageIterator(iter)
+	go func() {
+		defer iter.Close()
+		remain := conf.PageSize
+		for contexts.Continue(cxt) {
+			if conf.PageSize > 0 {
+				// request no more than we need to fill the page, so that the
+				// continuation token resumes exactly where the page ends
+				input.MaxKeys = aws.Int32(int32(min(remain, 1000)))
+			}
+			res, err := c.client.ListObjectsV2(cxt, input)
+			if err != nil {
+				iter.Cancel(blob.NewError(blob.OpList, c.url(prefix), kind(err), err))
+				return
+			}
+			for _, obj := range res.Contents {
+				err = iter.Write(blob.Resource{
+					URL:     c.url(aws.ToString(obj.Key)),
+					Size:    aws.ToInt64(obj.Size),
+					Created: aws.ToTime(obj.LastModified),
+					Updated: aws.ToTime(obj.LastModified),
+					ETag:    etag(obj.ETag),
+					MD5:     checksum(obj.ETag),
+				})
+				if err != nil {
+					return // already canceled
+				}
+			}
+			for _, pfx := range res.CommonPrefixes {
+				err = iter.Write(blob.Resource{
+					URL:      c.url(aws.ToString(pfx.Prefix)),
+					IsPrefix: true,
+				})
+				if err != nil {
+					return // already canceled
+				}
+			}
+			if !aws.ToBool(res.IsTruncated) {
+				return // no more pages
+			}
+			input.ContinuationToken = res.NextContinuationToken
+			if conf.PageSize > 0 {
+				remain -= int(aws.ToInt32(res.KeyCount))
+				if remain <= 0 {
+					page.SetNextPageToken(aws.ToString(res.NextContinuationToken))
+					return
+				}
+			}
+		}
+	}()
+
+	return page, nil
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (_ blob.Resource, err error) {
+	defer wrap(blob.OpStat, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	res, err := c.head(cxt, key)
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	return blob.Resource{
+		URL:                c.url(key),
+		ContentType:        aws.ToString(res.ContentType),
+		ContentEncoding:    aws.ToString(res.ContentEncoding),
+		ContentDisposition: aws.ToString(res.ContentDisposition),
+		ContentLanguage:    aws.ToString(res.ContentLanguage),
+		CacheControl:       aws.ToString(res.CacheControl),
+		Size:               aws.ToInt64(res.ContentLength),
+		Created:            aws.ToTime(res.LastModified),
+		Updated:            aws.ToTime(res.LastModified),
+		ETag:               etag(res.ETag),
+		MD5:                checksum(res.ETag),
+		Metadata:           res.Metadata,
+	}, nil
+}
+
+func (c *Client) head(cxt context.Context, key string) (*awss3.HeadObjectOutput, error) {
+	res, err := c.client.HeadObject(cxt, &awss3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return res, nil
+}
+
+// Accessor produces a presigned URL which permits the resource to be read
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (_ string, err error) {
+	defer wrap(blob.OpAccessor, rc, &err)
+	key, err := c.path(rc)
+	if err != nil {
+		return "", err
+	}
+	conf := blob.ReadConfig{}.WithOptions(opts)
+	expiry := conf.Expiry
+	if expiry <= 0 {
+		expiry = blob.DefaultExpiry
+	}
+	popts := []func(*awss3.PresignOptions){
+		awss3.WithPresignExpires(expiry),
+		withQuery(conf.Query),
+	}
+
+	var req *v4.PresignedHTTPRequest
+	switch m := strings.ToUpper(conf.Method); m {
+	case "", http.MethodGet:
+		req, err = c.presign.PresignGetObject(cxt, &awss3.GetObjectInput{
+			Bucket:                     aws.String(c.bucket),
+			Key:                        aws.String(key),
+			ResponseContentDisposition: optional(conf.ResponseContentDisposition),
+		}, popts...)
+	case http.MethodHead:
+		req, err = c.presign.PresignHeadObject(cxt, &awss3.HeadObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		}, popts...)
+	case http.MethodPut:
+		req, err = c.presign.PresignPutObject(cxt, &awss3.PutObjectInput{
+			Bucket:      aws.String(c.bucket),
+			Key:         aws.String(key),
+			ContentType: optional(conf.ContentType),
+		}, popts...)
+	case http.MethodDelete:
+		req, err = c.presign.PresignDeleteObject(cxt, &awss3.DeleteObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		}, popts...)
+	default:
+		return "", fmt.Errorf("%w: method %q", blob.ErrNotSupported, m)
+	}
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// withQuery includes additional query parameters in a presigned request.
+// They are added before the request is signed, so they're covered by the
+// signature.
+func withQuery(query url.Values) func(*awss3.PresignOptions) {
+	return func(o *awss3.PresignOptions) {
+		if len(query) == 0 {
+			return
+		}
+		o.ClientOptions = append(o.ClientOptions, func(o *awss3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Build.Add(middleware.BuildMiddlewareFunc("BlobQueryParams", func(cxt context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+					if req, ok := in.Request.(*smithyhttp.Request); ok {
+						q := req.URL.Query()
+						for k, v := range query {
+							q[k] = v
+						}
+						req.URL.RawQuery = q.Encode()
+					}
+					return next.HandleBuild(cxt, in)
+				}), middleware.After)
+			})
+		})
+	}
+}
+
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (_ blob.Writer, err error) {
+	defer wrap(blob.OpWrite, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Preconditions are enforced by S3 for uploads that fit in a single part,
+	// but they are not applied to multipart uploads, so we also check them
+	// beforehand on a best-effort basis
+	err = c.check(cxt, key, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	input := &awss3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	applyAttrs(input, conf)
+	if conf.IfNotExists {
+		input.IfNoneMatch = aws.String("*")
+	}
+	if v := conf.IfMatch; v != "" {
+		input.IfMatch = aws.String(strconv.Quote(v))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.NewUploader(c.client).Upload(cxt, input)
+		r.CloseWithError(err) // unblock the writer if the upload fails
+		done <- err
+	}()
+
+	return &writer{PipeWriter: w, cxt: cxt, client: c.client, bucket: c.bucket, key: key, url: c.url(key), done: done}, nil
+}
+
+// writer streams data to an upload, which is completed when it is closed
+type writer struct {
+	*io.PipeWriter
+	cxt     context.Context
+	client  *awss3.Client
+	bucket  string
+	key     string
+	url     string
+	done    <-chan error
+	aborted bool
+	closed  bool
+}
+
+// Abort fails the upload by failing the stream it reads from; S3 never stores
+// an object from an upload which fails, and a multipart upload which fails is
+// aborted
+func (w *writer) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	if err == nil {
+		err = blob.ErrAborted
+	}
+	w.aborted, w.closed = true, true
+	w.PipeWriter.CloseWithError(err)
+	w.abandon(<-w.done)
+	return nil
+}
+
+func (w *writer) Close() (err error) {
+	defer wrap(blob.OpWrite, w.url, &err)
+	if w.aborted {
+		return blob.ErrAborted
+	}
+	w.closed = true
+	if err := w.cxt.Err(); err != nil {
+		w.PipeWriter.CloseWithError(err) // canceled; the upload never completes
+		w.abandon(<-w.done)
+		return blob.ErrCanceled
+	}
+	w.PipeWriter.Close()
+	err = <-w.done
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// abandon aborts the multipart upload which failed with err, if any. The
+// uploader does this itself, but not once its context has been canceled.
+func (w *writer) abandon(err error) {
+	var failed manager.MultiUploadFailure
+	if errors.As(err, &failed) {
+		w.client.AbortMultipartUpload(context.WithoutCancel(w.cxt), &awss3.AbortMultipartUploadInput{
+			Bucket:   aws.String(w.bucket),
+			Key:      aws.String(w.key),
+			UploadId: aws.String(failed.UploadID()),
+		})
+	}
+}
+
+// applyAttrs sets the object attributes described by a configuration
+func applyAttrs(input *awss3.PutObjectInput, conf blob.WriteConfig) {
+	if v := conf.ContentType; v != "" {
+		input.ContentType = aws.String(v)
+	}
+	if v := conf.ContentEncoding; v != "" {
+		input.ContentEncoding = aws.String(v)
+	}
+	if v := conf.ContentDisposition; v != "" {
+		input.ContentDisposition = aws.String(v)
+	}
+	if v := conf.ContentLanguage; v != "" {
+		input.ContentLanguage = aws.String(v)
+	}
+	if v := conf.CacheControl; v != "" {
+		input.CacheControl = aws.String(v)
+	}
+	if v := conf.Metadata; v != nil {
+		input.Metadata = v
+	}
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpCopy, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	src, err = c.path(src)
+	if err != nil {
+		return err
+	}
+	dst, err = c.path(dst)
+	if err != nil {
+		return err
+	}
+	return c.copy(cxt, src, dst, nil, conf)
+}
+
+// copy copies an object. If the source has been described, it is only copied
+// if it is still the version described.
+func (c *Client) copy(cxt context.Context, src, dst string, res *awss3.HeadObjectOutput, conf blob.WriteConfig) error {
+	// S3 has no preconditions on the destination of a copy, so they can only
+	// be checked on a best-effort basis beforehand
+	err := c.check(cxt, dst, conf)
+	if err != nil {
+		return err
+	}
+	input := &awss3.CopyObjectInput{
+		Bucket:     aws.String(c.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(url.PathEscape(c.bucket) + "/" + url.PathEscape(src)),
+	}
+	if res != nil {
+		input.CopySourceIfMatch = res.ETag
+	}
+	if overrides(conf) {
+		// Attributes can only be replaced all together, so when we override any
+		// of them we must start from the source attributes in order to preserve
+		// the rest.
+		if res == nil {
+			res, err = c.head(cxt, src)
+			if err != nil {
+				return err
+			}
+		}
+		put := &awss3.PutObjectInput{
+			ContentType:        res.ContentType,
+			ContentEncoding:    res.ContentEncoding,
+			ContentDisposition: res.ContentDisposition,
+			ContentLanguage:    res.ContentLanguage,
+			CacheControl:       res.CacheControl,
+			Metadata:           res.Metadata,
+		}
+		applyAttrs(put, conf)
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.ContentType = put.ContentType
+		input.ContentEncoding = put.ContentEncoding
+		input.ContentDisposition = put.ContentDisposition
+		input.ContentLanguage = put.ContentLanguage
+		input.CacheControl = put.CacheControl
+		input.Metadata = put.Metadata
+	}
+	_, err = c.client.CopyObject(cxt, input)
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// overrides determines whether a configuration sets any object attributes
+func overrides(conf blob.WriteConfig) bool {
+	return conf.ContentType != "" || conf.ContentEncoding != "" || conf.ContentDisposition != "" || conf.ContentLanguage != "" || conf.CacheControl != "" || conf.Metadata != nil
+}
+
+// check tests the preconditions described by a configuration against the
+// current state of an object
+func (c *Client) check(cxt context.Context, key string, conf blob.WriteConfig) error {
+	if !conf.IfNotExists && conf.IfMatch == "" {
+		return nil
+	}
+	res, err := c.head(cxt, key)
+	if errors.Is(err, blob.ErrNotFound) {
+		if conf.IfMatch != "" {
+			return blob.ErrPreconditionFailed
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if conf.IfNotExists {
+		return blob.ErrPreconditionFailed
+	}
+	if conf.IfMatch != etag(res.ETag) {
+		return blob.ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpMove, src, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	src, err = c.path(src)
+	if err != nil {
+		return err
+	}
+	dst, err = c.path(dst)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil // nothing to do
+	}
+	res, err := c.head(cxt, src)
+	if err != nil {
+		return err
+	}
+	err = c.copy(cxt, src, dst, res, conf)
+	if err != nil {
+		return err
+	}
+	// only the version which was copied is deleted, so a write to the source
+	// which lands in between isn't lost
+	_, err = c.client.DeleteObject(cxt, &awss3.DeleteObjectInput{
+		Bucket:  aws.String(c.bucket),
+		Key:     aws.String(src),
+		IfMatch: res.ETag,
+	})
+	if err != nil {
+		err = mapError(err)
+		if errors.Is(err, blob.ErrPreconditionFailed) {
+			return fmt.Errorf("%w: %s changed while it was moved; it was copied but not deleted", blob.ErrPreconditionFailed, src)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDelete, rc, &err)
+	conf := blob.WriteConfig{}.WithOptions(opts)
+	key, err := c.path(rc)
+	if err != nil {
+		return err
+	}
+	// deleting an object that doesn't exist is not an error in S3, so we must
+	// check for it first
+	_, err = c.head(cxt, key)
+	if err != nil {
+		return err
+	}
+	input := &awss3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+	if v := conf.IfMatch; v != "" {
+		input.IfMatch = aws.String(strconv.Quote(v))
+	}
+	_, err = c.client.DeleteObject(cxt, input)
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// maxDeleteKeys is the maximum number of objects S3 deletes in one request
+const maxDeleteKeys = 1000
+
+// DeleteMany deletes objects in batches, using as few requests as possible.
+// Objects which do not exist are ignored.
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeleteMany, c.String(), &err)
+	errs := make(map[string]error)
+	keys := make([]string, 0, len(urls))
+	for _, u := range urls {
+		key, err := c.path(u)
+		if err != nil {
+			errs[u] = blob.NewError(blob.OpDelete, u, kind(err), err)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), maxDeleteKeys)
+		c.deleteObjects(cxt, keys[:n], errs)
+		keys = keys[n:]
+	}
+	if len(errs) > 0 {
+		return &blob.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// DeletePrefix deletes every object under a prefix, a page at a time
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) (err error) {
+	defer wrap(blob.OpDeletePrefix, prefix, &err)
+	key, err := c.path(prefix)
+	if err != nil {
+		return err
+	}
+	errs := make(map[string]error)
+	pages := awss3.NewListObjectsV2Paginator(c.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(key),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(cxt)
+		if err != nil {
+			return mapError(err)
+		}
+		keys := make([]string, len(page.Contents))
+		for i, obj := range page.Contents {
+			keys[i] = aws.ToString(obj.Key)
+		}
+		if len(keys) > 0 {
+			c.deleteObjects(cxt, keys, errs)
+		}
+	}
+	if len(errs) > 0 {
+		return &blob.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// deleteObjects deletes up to maxDeleteKeys objects in a single request,
+// recording any failures by URL
+func (c *Client) deleteObjects(cxt context.Context, keys []string, errs map[string]error) {
+	objs := make([]types.ObjectIdentifier, len(keys))
+	for i, k := range keys {
+		objs[i] = types.ObjectIdentifier{Key: aws.String(k)}
+	}
+	out, err := c.client.DeleteObjects(cxt, &awss3.DeleteObjectsInput{
+		Bucket: aws.String(c.bucket),
+		Delete: &types.Delete{
+			Objects: objs,
+			Quiet:   aws.Bool(true), // only report failures
+		},
+	})
+	if err != nil {
+		for _, k := range keys {
+			errs[c.url(k)] = blob.NewError(blob.OpDelete, c.url(k), kind(err), err)
+		}
+		return
+	}
+	for _, e := range out.Errors {
+		err = &smithy.GenericAPIError{Code: aws.ToString(e.Code), Message: aws.ToString(e.Message)}
+		errs[c.url(aws.ToString(e.Key))] = blob.NewError(blob.OpDelete, c.url(aws.ToString(e.Key)), kind(err), err)
+	}
+}
+
+func (c *Client) String() string {
+	return c.fqbp
+}
+
+// optional produces a pointer to a string, or nil if the string is empty
+func optional(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return aws.String(v)
+}
+
+// etag removes the quotes from an S3 ETag
+func etag(v *string) string {
+	if v == nil {
+		return ""
+	}
+	s := *v
+	if u, err := strconv.Unquote(s); err == nil {
+		s = u
+	}
+	return s
+}
+
+// checksum produces the MD5 checksum of an object from its ETag, which is
+// only possible for objects that were not uploaded in multiple parts
+func checksum(v *string) []byte {
+	sum, err := hex.DecodeString(etag(v))
+	if err != nil || len(sum) != 16 {
+		return nil
+	}
+	return sum
+}
+
+// wrap describes an error produced by an operation on an object, classifying
+// the S3 client's errors with kind
+func wrap(op blob.Op, rc string, err *error) {
+	*err = blob.NewError(op, rc, kind(*err), *err)
+}
+
+// mapError classifies an error produced by the S3 client, so that it matches
+// the corresponding sentinel error while retaining the original as its cause
+func mapError(err error) error {
+	if k := kind(err); k != nil && !errors.Is(err, k) {
+		return fmt.Errorf("%w: %w", k, err)
+	}
+	return err
+}
+
+// kind classifies an error produced by the S3 client
+func kind(err error) error {
+	if k := blob.Kind(err); k != nil {
+		return k
+	}
+	if errors.Is(err, ErrInvalidBucket) {
+		return blob.ErrInvalidURL
+	}
+	var aerr smithy.APIError
+	if errors.As(err, &aerr) {
+		switch aerr.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NotFound":
+			return blob.ErrNotFound
+		case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			return blob.ErrPermission
+		case "BucketAlreadyExists", "BucketAlreadyOwnedByYou":
+			return blob.ErrAlreadyExists
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return blob.ErrPreconditionFailed
+		case "InvalidRange":
+			return blob.ErrInvalidRange
+		case "SlowDown", "ServiceUnavailable", "InternalError", "RequestTimeout":
+			return blob.ErrUnavailable
+		}
+	}
+	var rerr *awshttp.ResponseError
+	if errors.As(err, &rerr) {
+		switch rerr.HTTPStatusCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return blob.ErrPermission
+		case http.StatusNotFound:
+			return blob.ErrNotFound
+		case http.StatusConflict:
+			return blob.ErrAlreadyExists
+		case http.StatusPreconditionFailed:
+			return blob.ErrPreconditionFailed
+		case http.StatusRequestedRangeNotSatisfiable:
+			return blob.ErrInvalidRange
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return blob.ErrUnavailable
+		}
+	}
+	return nil
+}
+
+func isStatus(err error, code int) bool {
+	var rerr *awshttp.ResponseError
+	return errors.As(err, &rerr) && rerr.HTTPStatusCode() == code
+}
@@ -0,0 +1,678 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/internal/conformance"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeObject is an object stored by the fake S3 service
+type fakeObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+	header   http.Header // content and user metadata headers
+}
+
+// fakeS3 is a minimal, in-process implementation of the subset of the S3 API
+// used by the client, addressed in path style
+type fakeS3 struct {
+	sync.Mutex
+	buckets map[string]map[string]*fakeObject
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: make(map[string]map[string]*fakeObject)}
+}
+
+var fakeHeaders = []string{"Content-Type", "Content-Encoding", "Content-Disposition", "Content-Language", "Cache-Control"}
+
+func (f *fakeS3) error(rsp http.ResponseWriter, status int, code string) {
+	rsp.Header().Set("Content-Type", "application/xml")
+	rsp.WriteHeader(status)
+	fmt.Fprintf(rsp, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	objs, ok := f.buckets[bucket]
+	if key == "" {
+		switch req.Method {
+		case http.MethodHead:
+			if !ok {
+				rsp.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			if !ok {
+				f.buckets[bucket] = make(map[string]*fakeObject)
+			}
+		case http.MethodGet:
+			if !ok {
+				f.error(rsp, http.StatusNotFound, "NoSuchBucket")
+				return
+			}
+			f.list(rsp, req, objs)
+		case http.MethodPost:
+			if !ok {
+				f.error(rsp, http.StatusNotFound, "NoSuchBucket")
+				return
+			}
+			if _, del := req.URL.Query()["delete"]; !del {
+				f.error(rsp, http.StatusMethodNotAllowed, "MethodNotAllowed")
+				return
+			}
+			f.deleteMany(rsp, req, objs)
+		default:
+			f.error(rsp, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+	if !ok {
+		f.error(rsp, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	obj, exists := objs[key]
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			f.error(rsp, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for k, v := range obj.header {
+			rsp.Header()[k] = v
+		}
+		rsp.Header().Set("ETag", strconv.Quote(obj.etag))
+		rsp.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		data, status := obj.data, http.StatusOK
+		if v := req.Header.Get("Range"); v != "" {
+			var lo, hi int
+			size := len(data)
+			switch spec := strings.TrimPrefix(v, "bytes="); {
+			case strings.HasPrefix(spec, "-"):
+				n, _ := strconv.Atoi(spec[1:])
+				lo, hi = max(size-n, 0), size-1
+			case strings.HasSuffix(spec, "-"):
+				lo, _ = strconv.Atoi(strings.TrimSuffix(spec, "-"))
+				hi = size - 1
+			default:
+				a, b, _ := strings.Cut(spec, "-")
+				lo, _ = strconv.Atoi(a)
+				hi, _ = strconv.Atoi(b)
+				hi = min(hi, size-1)
+			}
+			if lo >= size {
+				f.error(rsp, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			rsp.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", lo, hi, size))
+			data, status = data[lo:hi+1], http.StatusPartialContent
+		}
+		rsp.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		rsp.WriteHeader(status)
+		if req.Method == http.MethodGet {
+			rsp.Write(data)
+		}
+
+	case http.MethodPut:
+		if v := req.Header.Get("If-None-Match"); v == "*" && exists {
+			f.error(rsp, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if v := req.Header.Get("If-Match"); v != "" && (!exists || v != strconv.Quote(obj.etag)) {
+			f.error(rsp, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		var data []byte
+		header := make(http.Header)
+		if src := req.Header.Get("X-Amz-Copy-Source"); src != "" {
+			src, _ = url.PathUnescape(src)
+			sbucket, skey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+			sobj, ok := f.buckets[sbucket][skey]
+			if !ok {
+				f.error(rsp, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			if v := req.Header.Get("X-Amz-Copy-Source-If-Match"); v != "" && v != strconv.Quote(sobj.etag) {
+				f.error(rsp, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+			data = sobj.data
+			if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+				header = metaHeaders(req.Header)
+			} else {
+				header = sobj.header.Clone()
+			}
+		} else {
+			var err error
+			data, err = io.ReadAll(req.Body)
+			if err != nil {
+				f.error(rsp, http.StatusBadRequest, "IncompleteBody")
+				return
+			}
+			header = metaHeaders(req.Header)
+		}
+		sum := md5.Sum(data)
+		obj = &fakeObject{
+			data:     data,
+			etag:     hex.EncodeToString(sum[:]),
+			modified: time.Now().UTC(),
+			header:   header,
+		}
+		objs[key] = obj
+		rsp.Header().Set("ETag", strconv.Quote(obj.etag))
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			fmt.Fprintf(rsp, "<CopyObjectResult><ETag>%s</ETag><LastModified>%s</LastModified></CopyObjectResult>", strconv.Quote(obj.etag), obj.modified.Format(time.RFC3339))
+		}
+
+	case http.MethodDelete:
+		if v := req.Header.Get("If-Match"); v != "" && (!exists || v != strconv.Quote(obj.etag)) {
+			f.error(rsp, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		delete(objs, key)
+		rsp.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.error(rsp, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func metaHeaders(h http.Header) http.Header {
+	m := make(http.Header)
+	for _, k := range fakeHeaders {
+		if v := h.Get(k); v != "" {
+			m.Set(k, v)
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+type fakeContents struct {
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified string
+}
+
+type fakePrefix struct {
+	Prefix string
+}
+
+type fakeDelete struct {
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type fakeDeleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []struct {
+		Key string
+	}
+}
+
+func (f *fakeS3) deleteMany(rsp http.ResponseWriter, req *http.Request, objs map[string]*fakeObject) {
+	var del fakeDelete
+	if err := xml.NewDecoder(req.Body).Decode(&del); err != nil {
+		f.error(rsp, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	var res fakeDeleteResult
+	for _, e := range del.Objects {
+		delete(objs, e.Key) // keys that don't exist are deleted successfully
+		res.Deleted = append(res.Deleted, struct{ Key string }{e.Key})
+	}
+	rsp.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(rsp).Encode(res)
+}
+
+type fakeListing struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string         `xml:",omitempty"`
+	Contents              []fakeContents `xml:"Contents"`
+	CommonPrefixes        []fakePrefix   `xml:"CommonPrefixes"`
+}
+
+func (f *fakeS3) list(rsp http.ResponseWriter, req *http.Request, objs map[string]*fakeObject) {
+	q := req.URL.Query()
+	prefix, delim := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("continuation-token")
+	if v := q.Get("start-after"); v > after {
+		after = v
+	}
+	limit := 1000
+	if v, err := strconv.Atoi(q.Get("max-keys")); err == nil && v > 0 {
+		limit = v
+	}
+
+	keys := make([]string, 0, len(objs))
+	for k := range objs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := fakeListing{Name: req.URL.Path[1:], Prefix: prefix, MaxKeys: limit}
+	seen := make(map[string]bool)
+	var last string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			continue
+		}
+		if delim != "" {
+			if x := strings.Index(k[len(prefix):], delim); x >= 0 {
+				p := k[:len(prefix)+x+len(delim)]
+				if seen[p] || p <= after {
+					continue
+				}
+				if res.KeyCount == limit {
+					res.IsTruncated = true
+					break
+				}
+				seen[p] = true
+				res.CommonPrefixes = append(res.CommonPrefixes, fakePrefix{Prefix: p})
+				res.KeyCount++
+				last = p
+				continue
+			}
+		}
+		if res.KeyCount == limit {
+			res.IsTruncated = true
+			break
+		}
+		obj := objs[k]
+		res.Contents = append(res.Contents, fakeContents{
+			Key:          k,
+			ETag:         strconv.Quote(obj.etag),
+			Size:         int64(len(obj.data)),
+			LastModified: obj.modified.Format(time.RFC3339),
+		})
+		res.KeyCount++
+		last = k
+	}
+	if res.IsTruncated {
+		res.NextContinuationToken = last
+	}
+	rsp.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(rsp).Encode(res)
+}
+
+func TestS3CRUD(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	svc := httptest.NewServer(newFakeS3())
+	defer svc.Close()
+
+	fqbp := "s3://integration/bucket"
+	store, err := New(cxt, fqbp+"?region=us-east-1&path_style=true&endpoint="+url.QueryEscape(svc.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// init creates the bucket we're using if it doesn't already exist
+	err = store.Init(cxt)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	d1 := `Hello, this is the data.`
+	d2 := `Hello, this is the updated data.`
+
+	// write a resource
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err := w.Write([]byte(d1))
+	assert.NoError(t, err)
+	assert.Equal(t, len(d1), n)
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// this is the same resource, using the URL resource indicator
+	dsn = fqbp + "/file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err = w.Write([]byte(d2)) // write second version
+	assert.NoError(t, err)
+	assert.Equal(t, len(d2), n)
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+
+	// the result must be the second version
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err := store.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, d2, string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read part of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err = store.Read(cxt, dsn, blob.WithRange(7, 4))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "this", string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err = store.Read(cxt, dsn, blob.WithOffset(-5))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "data.", string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read part of the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	r, err = store.Read(cxt, dsn, blob.WithRange(-5, 4))
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "data", string(d))
+		assert.NoError(t, r.Close())
+	}
+
+	// read beyond the end of the resource
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn, blob.WithOffset(1000))
+	assert.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// this file doesn't exist
+	dsn = "fileZ"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// write a resource with attributes
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn,
+		blob.WithContentType("text/plain"),
+		blob.WithCacheControl("no-cache"),
+		blob.WithMetadata(map[string]string{"owner": "tests"}),
+	)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	// the attributes are described along with the resource
+	dsn = "meta1"
+	fmt.Printf("<= %s\n", dsn)
+	m1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, fqbp+"/meta1", m1.URL)
+		assert.Equal(t, int64(len(d1)), m1.Size)
+		assert.Equal(t, "text/plain", m1.ContentType)
+		assert.Equal(t, "no-cache", m1.CacheControl)
+		assert.Equal(t, map[string]string{"owner": "tests"}, m1.Metadata)
+		assert.Len(t, m1.MD5, 16)
+	}
+
+	// copies preserve the attributes that aren't overridden
+	dsn = "meta1"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "copy/meta2", blob.WithContentType("application/json"))
+	if assert.NoError(t, err) {
+		m2, err := store.Stat(cxt, "copy/meta2")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m2.ContentType)
+			assert.Equal(t, "no-cache", m2.CacheControl)
+			assert.Equal(t, map[string]string{"owner": "tests"}, m2.Metadata)
+		}
+	}
+
+	// move the copy somewhere else
+	dsn = "copy/meta2"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Move(cxt, dsn, "dir/meta3")
+	if assert.NoError(t, err) {
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+		m3, err := store.Stat(cxt, "dir/meta3")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "application/json", m3.ContentType)
+		}
+	}
+
+	// a resource that doesn't exist can't be copied
+	dsn = "fileZ"
+	fmt.Printf("=> %s\n", dsn)
+	err = store.Copy(cxt, dsn, "file3")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	// list everything in the store
+	tree := make(map[string]struct{})
+	iter, err := store.List(cxt, "")
+	if assert.NoError(t, err) {
+		for {
+			rc, err := iter.Next()
+			if siter.IsFinished(err) {
+				break
+			} else if !assert.NoError(t, err) {
+				break
+			}
+			fmt.Printf("<... %v\n", rc.URL)
+			tree[rc.URL] = struct{}{}
+		}
+	}
+	assert.Equal(t, map[string]struct{}{
+		fqbp + "/file1":     {},
+		fqbp + "/meta1":     {},
+		fqbp + "/dir/meta3": {},
+	}, tree)
+
+	// page through the same listing, a few entries at a time
+	var paged []string
+	for token := ""; ; {
+		iter, err := store.List(cxt, "", blob.WithPageSize(2), blob.WithPageToken(token))
+		if !assert.NoError(t, err) {
+			break
+		}
+		res, err := siter.CollectErr(iter, nil)
+		if !assert.NoError(t, err) || !assert.LessOrEqual(t, len(res), 2) {
+			break
+		}
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			paged = append(paged, rc.URL)
+		}
+		if token = blob.NextPageToken(iter); token == "" {
+			break
+		}
+	}
+	if assert.Len(t, paged, len(tree)) {
+		for _, e := range paged {
+			assert.Contains(t, tree, e)
+		}
+	}
+
+	// list only the immediate children of the prefix
+	res, err := siter.CollectErr(store.List(cxt, "", blob.WithDelimiter("/")))
+	if assert.NoError(t, err) {
+		children := make(map[string]bool)
+		for _, rc := range res {
+			fmt.Printf("<... %v\n", rc.URL)
+			children[rc.URL] = rc.IsPrefix
+		}
+		assert.Equal(t, map[string]bool{
+			fqbp + "/file1": false,
+			fqbp + "/meta1": false,
+			fqbp + "/dir/":  true,
+		}, children)
+	}
+
+	// an aborted write stores nothing, even after being closed, nor does a
+	// write whose context ends before it is closed
+	conformance.Abort(t, cxt, store, "aborted1")
+
+	// conditionally create a resource, only once
+	dsn = "cond1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Close())
+	}
+	_, err = store.Write(cxt, dsn, blob.WithIfNotExists())
+	assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+
+	// a stale version can't be used to delete it, but the current one can
+	dsn = "cond1"
+	fmt.Printf("~~ %s\n", dsn)
+	c1, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		err = store.Delete(cxt, dsn, blob.WithIfMatch("not-the-version"))
+		assert.ErrorIs(t, err, blob.ErrPreconditionFailed)
+		err = store.Delete(cxt, dsn, blob.WithIfMatch(c1.ETag))
+		assert.NoError(t, err)
+	}
+
+	// obtain an accessor for the resource, which is a presigned URL
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	a1, err := store.Accessor(cxt, dsn)
+	if assert.NoError(t, err) {
+		rsp, err := http.Get(a1)
+		if assert.NoError(t, err) {
+			d, err := io.ReadAll(rsp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, d2, string(d))
+			rsp.Body.Close()
+		}
+	}
+
+	// obtain a download accessor with response headers and extra parameters
+	dsn = "file1"
+	fmt.Printf("<= %s\n", dsn)
+	a2, err := store.Accessor(cxt, dsn,
+		blob.WithExpiry(time.Minute),
+		blob.WithResponseContentDisposition(`attachment; filename="file1.txt"`),
+		blob.WithQueryParam("x-id", "download"),
+	)
+	if assert.NoError(t, err) {
+		u, err := url.Parse(a2)
+		if assert.NoError(t, err) {
+			q := u.Query()
+			assert.Equal(t, "60", q.Get("X-Amz-Expires"))
+			assert.Equal(t, `attachment; filename="file1.txt"`, q.Get("response-content-disposition"))
+			assert.Equal(t, "download", q.Get("x-id"))
+		}
+	}
+
+	// upload a resource directly via an accessor
+	dsn = "upload1"
+	fmt.Printf("=> %s\n", dsn)
+	a3, err := store.Accessor(cxt, dsn, blob.WithMethod("PUT"), blob.WithRequiredContentType("text/plain"))
+	if assert.NoError(t, err) {
+		req, err := http.NewRequest(http.MethodPut, a3, strings.NewReader(d1))
+		if assert.NoError(t, err) {
+			req.Header.Set("Content-Type", "text/plain")
+			rsp, err := http.DefaultClient.Do(req)
+			if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, rsp.StatusCode)
+				rsp.Body.Close()
+			}
+		}
+		u1, err := store.Stat(cxt, dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "text/plain", u1.ContentType)
+			assert.Equal(t, int64(len(d1)), u1.Size)
+		}
+		assert.NoError(t, store.Delete(cxt, dsn))
+	}
+	_, err = store.Accessor(cxt, dsn, blob.WithMethod("PATCH"))
+	assert.ErrorIs(t, err, blob.ErrNotSupported)
+
+	// delete resources in bulk, then everything under a prefix
+	for _, e := range []string{"bulk/a", "bulk/b", "bulk/c/d", "bulk/c/e"} {
+		w, err = store.Write(cxt, e)
+		if assert.NoError(t, err) {
+			_, err = w.Write([]byte(d1))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+		}
+	}
+	err = blob.DeleteMany(cxt, store, []string{"bulk/a", "bulk/c/d", "bulk/missing"}, blob.WithConcurrency(2))
+	assert.NoError(t, err)
+	_, err = store.Stat(cxt, "bulk/a")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, "bulk/b")
+	assert.NoError(t, err)
+	err = blob.DeletePrefix(cxt, store, "bulk/")
+	assert.NoError(t, err)
+	for _, e := range []string{"bulk/b", "bulk/c/e"} {
+		_, err = store.Stat(cxt, e)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+	// delete our resources
+	for _, e := range []string{"file1", "meta1", "dir/meta3"} {
+		fmt.Printf("~~ %s\n", e)
+		assert.NoError(t, store.Delete(cxt, e))
+	}
+
+	// they shouldn't exist now
+	dsn = "file1"
+	fmt.Printf("~~ %s\n", dsn)
+	assert.ErrorIs(t, store.Delete(cxt, dsn), blob.ErrNotFound)
+	_, err = store.Read(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
@@ -0,0 +1,373 @@
+// Package instrument traces and measures the operations performed on any
+// blob client with OpenTelemetry.
+//
+// Every operation produces a span and a measurement of its duration. Reads,
+// writes, and listings last until the reader or writer is closed or the
+// listing is consumed, rather than only until the call which began them
+// returns, so their spans and durations cover the transfer itself. The bytes
+// read and written are counted, and failed operations are counted by the
+// kind of error which caused them.
+package instrument
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the name of the instrumentation scope of the tracer and meter
+const Name = "github.com/bww/go-blob/v1/instrument"
+
+// Attributes which describe an operation
+const (
+	AttrOperation = attribute.Key("blob.operation")
+	AttrScheme    = attribute.Key("blob.scheme")
+	AttrBucket    = attribute.Key("blob.bucket")
+	AttrKey       = attribute.Key("blob.key")
+	AttrBytes     = attribute.Key("blob.bytes")
+	AttrErrorType = attribute.Key("error.type")
+)
+
+// errorTypes names the kinds of errors by which failed operations are
+// counted; any other error is counted as "other"
+var errorTypes = map[error]string{
+	blob.ErrNotFound:           "not_found",
+	blob.ErrInvalidURL:         "invalid_url",
+	blob.ErrNotSupported:       "not_supported",
+	blob.ErrInvalidRange:       "invalid_range",
+	blob.ErrInvalidToken:       "invalid_token",
+	blob.ErrAborted:            "aborted",
+	blob.ErrPermission:         "permission",
+	blob.ErrAlreadyExists:      "already_exists",
+	blob.ErrPreconditionFailed: "precondition_failed",
+	blob.ErrUnavailable:        "unavailable",
+	blob.ErrCanceled:           "canceled",
+}
+
+// ErrorType produces the kind of an error, as it is recorded
+func ErrorType(err error) string {
+	if t, ok := errorTypes[blob.Kind(err)]; ok {
+		return t
+	}
+	return "other"
+}
+
+type Config struct {
+	TracerProvider trace.TracerProvider // the provider of the tracer which produces spans; nil uses the global provider
+	MeterProvider  metric.MeterProvider // the provider of the meter which records metrics; nil uses the global provider
+}
+
+// Client instruments the operations it performs on the client it wraps.
+// Resources are described by the scheme and bucket of the client, which are
+// those of its URL, and the key with which an operation is performed.
+type Client struct {
+	client   blob.Client
+	tracer   trace.Tracer
+	scheme   string
+	bucket   string
+	duration metric.Float64Histogram
+	read     metric.Int64Counter
+	written  metric.Int64Counter
+	errors   metric.Int64Counter
+}
+
+func New(client blob.Client) (*Client, error) {
+	return NewWithConfig(client, Config{})
+}
+
+func NewWithConfig(client blob.Client, conf Config) (*Client, error) {
+	tp := conf.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := conf.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	c := &Client{
+		client: client,
+		tracer: tp.Tracer(Name),
+	}
+	if u, err := url.Parse(fmt.Sprint(client)); err == nil {
+		c.scheme, c.bucket = u.Scheme, u.Host
+	}
+
+	meter := mp.Meter(Name)
+	var err error
+	c.duration, err = meter.Float64Histogram("blob.client.operation.duration", metric.WithUnit("s"), metric.WithDescription("The duration of blob operations, including the transfer of the content they read or write"))
+	if err != nil {
+		return nil, err
+	}
+	c.read, err = meter.Int64Counter("blob.client.read", metric.WithUnit("By"), metric.WithDescription("The number of bytes read"))
+	if err != nil {
+		return nil, err
+	}
+	c.written, err = meter.Int64Counter("blob.client.written", metric.WithUnit("By"), metric.WithDescription("The number of bytes written"))
+	if err != nil {
+		return nil, err
+	}
+	c.errors, err = meter.Int64Counter("blob.client.errors", metric.WithUnit("{error}"), metric.WithDescription("The number of failed blob operations, by the type of error"))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// operation is a span, and the measurements which are recorded when it ends
+type operation struct {
+	client *Client
+	cxt    context.Context
+	span   trace.Span
+	start  time.Time
+	attrs  []attribute.KeyValue
+	set    metric.MeasurementOption // the attributes with which the operation is measured
+	once   sync.Once
+}
+
+// begin begins an operation on a resource, producing the context in which it
+// is performed
+func (c *Client) begin(cxt context.Context, op blob.Op, rc string) (context.Context, *operation) {
+	attrs := []attribute.KeyValue{
+		AttrOperation.String(string(op)),
+		AttrScheme.String(c.scheme),
+		AttrBucket.String(c.bucket),
+	}
+	var key []attribute.KeyValue
+	if rc != "" {
+		key = append(key, AttrKey.String(rc))
+	}
+	cxt, span := c.tracer.Start(cxt, "blob."+strings.ReplaceAll(string(op), " ", "_"),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(key...),
+	)
+	return cxt, &operation{
+		client: c,
+		cxt:    cxt,
+		span:   span,
+		start:  time.Now(),
+		attrs:  attrs,
+		set:    metric.WithAttributeSet(attribute.NewSet(attrs...)),
+	}
+}
+
+// end ends an operation's span and records its duration, along with its
+// error if err is not nil. Only the first call has any effect.
+func (o *operation) end(err error) {
+	o.once.Do(func() {
+		d := time.Since(o.start).Seconds()
+		if err != nil {
+			t := AttrErrorType.String(ErrorType(err))
+			set := metric.WithAttributes(append(o.attrs, t)...)
+			o.span.RecordError(err)
+			o.span.SetStatus(codes.Error, err.Error())
+			o.span.SetAttributes(t)
+			o.client.errors.Add(o.cxt, 1, set)
+			o.client.duration.Record(o.cxt, d, set)
+		} else {
+			o.client.duration.Record(o.cxt, d, o.set)
+		}
+		o.span.End()
+	})
+}
+
+func (c *Client) call(cxt context.Context, op blob.Op, rc string, f func(context.Context) error) error {
+	cxt, o := c.begin(cxt, op, rc)
+	err := f(cxt)
+	o.end(err)
+	return err
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpInit, "", func(cxt context.Context) error {
+		return c.client.Init(cxt, opts...)
+	})
+}
+
+// Read reads a resource. Its span lasts until the reader is closed, and the
+// bytes read are counted as they are read.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+	cxt, o := c.begin(cxt, blob.OpRead, rc)
+	r, err := c.client.Read(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &reader{r: r, op: o}, nil
+}
+
+type reader struct {
+	r   io.ReadCloser
+	op  *operation
+	n   int64
+	err error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.op.client.read.Add(r.op.cxt, int64(n), r.op.set)
+	}
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *reader) Close() error {
+	err := r.r.Close()
+	r.op.span.SetAttributes(AttrBytes.Int64(r.n))
+	if r.err != nil {
+		r.op.end(r.err)
+	} else {
+		r.op.end(err)
+	}
+	return err
+}
+
+// List lists resources. Its span lasts until the listing is consumed, fails,
+// or is closed.
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	cxt, o := c.begin(cxt, blob.OpList, rc)
+	iter, err := c.client.List(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &lister{Iterator: iter, op: o}, nil
+}
+
+type lister struct {
+	siter.Iterator[blob.Resource]
+	op *operation
+}
+
+func (l *lister) Next() (blob.Resource, error) {
+	v, err := l.Iterator.Next()
+	if errors.Is(err, siter.ErrClosed) {
+		l.op.end(nil)
+	} else if errors.Is(err, siter.ErrCanceled) {
+		l.op.end(fmt.Errorf("%w: %w", blob.ErrCanceled, err))
+	} else if err != nil {
+		l.op.end(err)
+	}
+	return v, err
+}
+
+func (l *lister) NextPageToken() string {
+	return blob.NextPageToken(l.Iterator)
+}
+
+func (l *lister) Close() {
+	l.Iterator.Close()
+	l.op.end(nil)
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (res blob.Resource, err error) {
+	err = c.call(cxt, blob.OpStat, rc, func(cxt context.Context) error {
+		res, err = c.client.Stat(cxt, rc, opts...)
+		return err
+	})
+	return res, err
+}
+
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (u string, err error) {
+	err = c.call(cxt, blob.OpAccessor, rc, func(cxt context.Context) error {
+		u, err = c.client.Accessor(cxt, rc, opts...)
+		return err
+	})
+	return u, err
+}
+
+// Write writes a resource. Its span lasts until the writer is closed or
+// aborted, and the bytes written are counted as they are written.
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	cxt, o := c.begin(cxt, blob.OpWrite, rc)
+	w, err := c.client.Write(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &writer{Writer: w, op: o}, nil
+}
+
+type writer struct {
+	blob.Writer
+	op *operation
+	n  int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if n > 0 {
+		w.n += int64(n)
+		w.op.client.written.Add(w.op.cxt, int64(n), w.op.set)
+	}
+	return n, err
+}
+
+func (w *writer) Abort(err error) error {
+	res := w.Writer.Abort(err)
+	w.op.span.SetAttributes(AttrBytes.Int64(w.n))
+	w.op.end(fmt.Errorf("%w: %v", blob.ErrAborted, err))
+	return res
+}
+
+func (w *writer) Close() error {
+	err := w.Writer.Close()
+	w.op.span.SetAttributes(AttrBytes.Int64(w.n))
+	w.op.end(err)
+	return err
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpCopy, src, func(cxt context.Context) error {
+		return c.client.Copy(cxt, src, dst, opts...)
+	})
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpMove, src, func(cxt context.Context) error {
+		return c.client.Move(cxt, src, dst, opts...)
+	})
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDelete, rc, func(cxt context.Context) error {
+		return c.client.Delete(cxt, rc, opts...)
+	})
+}
+
+// DeleteMany is recorded as one span and one operation for the whole batch,
+// with no key; the resources in it are not recorded individually
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDeleteMany, "", func(cxt context.Context) error {
+		return blob.DeleteMany(cxt, c.client, urls, opts...)
+	})
+}
+
+// DeletePrefix is recorded as one span and one operation, keyed by the
+// prefix
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDeletePrefix, prefix, func(cxt context.Context) error {
+		return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+	})
+}
+
+func (c *Client) String() string {
+	return fmt.Sprint(c.client)
+}
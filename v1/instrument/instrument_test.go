@@ -0,0 +1,170 @@
+package instrument
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrument(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://instrument")
+	if !assert.NoError(t, err) {
+		return
+	}
+	spans := tracetest.NewSpanRecorder()
+	metrics := sdkmetric.NewManualReader()
+	store, err := NewWithConfig(backend, Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// ended produces the ended spans with the specified name
+	ended := func(name string) []sdktrace.ReadOnlySpan {
+		var res []sdktrace.ReadOnlySpan
+		for _, e := range spans.Ended() {
+			if e.Name() == name {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+	// attr produces the value of a span attribute
+	attr := func(s sdktrace.ReadOnlySpan, k attribute.Key) attribute.Value {
+		for _, e := range s.Attributes() {
+			if e.Key == k {
+				return e.Value
+			}
+		}
+		return attribute.Value{}
+	}
+	// sum produces the sum of a counter, or the count of a histogram, over
+	// the data points which have the specified attributes
+	sum := func(name string, attrs ...attribute.KeyValue) int64 {
+		var rm metricdata.ResourceMetrics
+		assert.NoError(t, metrics.Collect(cxt, &rm))
+		var n int64
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != name {
+					continue
+				}
+				switch d := m.Data.(type) {
+				case metricdata.Sum[int64]:
+					for _, p := range d.DataPoints {
+						if has(p.Attributes, attrs) {
+							n += p.Value
+						}
+					}
+				case metricdata.Histogram[float64]:
+					for _, p := range d.DataPoints {
+						if has(p.Attributes, attrs) {
+							n += int64(p.Count)
+						}
+					}
+				}
+			}
+		}
+		return n
+	}
+
+	d1 := "Hello, this is the data."
+
+	// a write lasts until it is closed, and counts what was written
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(cxt, dsn, blob.WithContentType("text/plain"))
+	if assert.NoError(t, err) {
+		for _, e := range []string{d1[:5], d1[5:]} {
+			_, err = w.Write([]byte(e))
+			assert.NoError(t, err)
+		}
+		assert.Len(t, ended("blob.write"), 0)
+		assert.NoError(t, w.Close())
+	}
+	if s := ended("blob.write"); assert.Len(t, s, 1) {
+		assert.Equal(t, "mem", attr(s[0], AttrScheme).AsString())
+		assert.Equal(t, "instrument", attr(s[0], AttrBucket).AsString())
+		assert.Equal(t, dsn, attr(s[0], AttrKey).AsString())
+		assert.Equal(t, int64(len(d1)), attr(s[0], AttrBytes).AsInt64())
+		assert.Equal(t, codes.Unset, s[0].Status().Code)
+	}
+	assert.Equal(t, int64(len(d1)), sum("blob.client.written"))
+
+	// so does a read
+	fmt.Printf("<= %s\n", dsn)
+	r, err := store.Read(cxt, dsn)
+	if assert.NoError(t, err) {
+		d, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, d1, string(d))
+		assert.Len(t, ended("blob.read"), 0)
+		assert.NoError(t, r.Close())
+	}
+	if s := ended("blob.read"); assert.Len(t, s, 1) {
+		assert.Equal(t, int64(len(d1)), attr(s[0], AttrBytes).AsInt64())
+	}
+	assert.Equal(t, int64(len(d1)), sum("blob.client.read"))
+	assert.Equal(t, int64(1), sum("blob.client.operation.duration", AttrOperation.String("read")))
+
+	// as does a listing, until it is consumed
+	_, err = siter.CollectErr(store.List(cxt, ""))
+	assert.NoError(t, err)
+	assert.Len(t, ended("blob.list"), 1)
+
+	// failures are recorded by the kind of error
+	dsn = "missing"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	if s := ended("blob.stat"); assert.Len(t, s, 1) {
+		assert.Equal(t, codes.Error, s[0].Status().Code)
+		assert.Equal(t, "not_found", attr(s[0], AttrErrorType).AsString())
+	}
+	assert.Equal(t, int64(1), sum("blob.client.errors", AttrOperation.String("stat"), AttrErrorType.String("not_found")))
+
+	dsn = "aborted"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+	}
+	assert.Equal(t, int64(1), sum("blob.client.errors", AttrOperation.String("write"), AttrErrorType.String("aborted")))
+	assert.Equal(t, int64(2), sum("blob.client.operation.duration", AttrOperation.String("write")))
+
+	// clean up
+	err = blob.DeletePrefix(cxt, store, "")
+	assert.NoError(t, err)
+	assert.Len(t, ended("blob.delete_prefix"), 1)
+}
+
+// has determines whether a set includes every specified attribute
+func has(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, e := range attrs {
+		if v, ok := set.Value(e.Key); !ok || v != e.Value {
+			return false
+		}
+	}
+	return true
+}
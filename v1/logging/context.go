@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey struct{}
+
+// With produces a context which carries attributes, specified as they are
+// to slog.Logger.Log; for example, a request ID. A ContextHandler adds them
+// to every record which is logged with the context.
+func With(cxt context.Context, args ...any) context.Context {
+	attrs := Attrs(cxt)
+	attrs = append(attrs[:len(attrs):len(attrs)], slog.Group("", args...).Value.Group()...)
+	return context.WithValue(cxt, contextKey{}, attrs)
+}
+
+// Attrs produces the attributes carried by a context
+func Attrs(cxt context.Context) []slog.Attr {
+	attrs, _ := cxt.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
+
+// ContextHandler adds the attributes carried by the context with which a
+// record is logged to the record before it is handled. They are added at the
+// top level, outside any groups the handler was given with WithGroup, so a
+// request ID is logged in the same place by every logger.
+type ContextHandler struct {
+	base    slog.Handler // the handler, before any attributes or groups were applied
+	handler slog.Handler // the handler, with them
+	scopes  []scope
+}
+
+// scope is a group or a set of attributes applied to a handler
+type scope struct {
+	group string
+	attrs []slog.Attr
+}
+
+func (s scope) apply(h slog.Handler) slog.Handler {
+	if s.group != "" {
+		return h.WithGroup(s.group)
+	}
+	return h.WithAttrs(s.attrs)
+}
+
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{base: handler, handler: handler}
+}
+
+func (h *ContextHandler) Enabled(cxt context.Context, level slog.Level) bool {
+	return h.handler.Enabled(cxt, level)
+}
+
+func (h *ContextHandler) Handle(cxt context.Context, r slog.Record) error {
+	attrs := Attrs(cxt)
+	if len(attrs) == 0 {
+		return h.handler.Handle(cxt, r)
+	}
+	handler := h.base.WithAttrs(attrs)
+	for _, e := range h.scopes {
+		handler = e.apply(handler)
+	}
+	return handler.Handle(cxt, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(scope{attrs: attrs})
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(scope{group: name})
+}
+
+// with produces a handler to which a scope is applied
+func (h *ContextHandler) with(s scope) *ContextHandler {
+	return &ContextHandler{
+		base:    h.base,
+		handler: s.apply(h.handler),
+		scopes:  append(h.scopes[:len(h.scopes):len(h.scopes)], s),
+	}
+}
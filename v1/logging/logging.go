@@ -0,0 +1,345 @@
+// Package logging logs the operations performed on any blob client with
+// slog.
+//
+// Every operation is logged once, when it completes, with the URL of the
+// resource it was performed on, its duration and its outcome. Reads,
+// writes, and listings complete when the reader or writer is closed or the
+// listing is consumed, so their durations cover the transfer itself and they
+// record the number of bytes or resources transferred.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// Outcomes of an operation
+const (
+	OutcomeOK       = "ok"
+	OutcomeNotFound = "not_found"
+	OutcomeAborted  = "aborted"
+	OutcomeCanceled = "canceled"
+	OutcomeError    = "error"
+)
+
+type Config struct {
+	Logger *slog.Logger           // the logger to which operations are logged; nil uses the default logger, with a ContextHandler
+	Level  slog.Level             // the level at which operations are logged; the zero value is Info
+	Levels map[blob.Op]slog.Level // the levels at which specific operations are logged, overriding Level
+	Sample map[blob.Op]int        // log only one in every n successful operations of a kind; failures are always logged
+}
+
+// Client logs the operations it performs on the client it wraps.
+//
+// Successful operations are logged at the level configured for them. Failed
+// operations are logged at no less than Warn if the resource was not found,
+// the operation was canceled, or a write was aborted, and at no less than
+// Error otherwise.
+type Client struct {
+	client blob.Client
+	log    *slog.Logger
+	base   string // the URL of the client, against which keys are resolved
+	level  slog.Level
+	levels map[blob.Op]slog.Level
+	sample map[blob.Op]int
+	counts map[blob.Op]*atomic.Uint64
+}
+
+func New(client blob.Client) *Client {
+	return NewWithConfig(client, Config{})
+}
+
+func NewWithConfig(client blob.Client, conf Config) *Client {
+	log := conf.Logger
+	if log == nil {
+		log = slog.New(NewContextHandler(slog.Default().Handler()))
+	}
+	counts := make(map[blob.Op]*atomic.Uint64)
+	for op := range conf.Sample {
+		counts[op] = &atomic.Uint64{}
+	}
+	return &Client{
+		client: client,
+		log:    log,
+		base:   strings.TrimSuffix(fmt.Sprint(client), "/") + "/",
+		level:  conf.Level,
+		levels: conf.Levels,
+		sample: conf.Sample,
+		counts: counts,
+	}
+}
+
+// url produces the URL of a resource, which may be identified by its key
+// or by its URL
+func (c *Client) url(rc string) string {
+	if strings.Contains(rc, "://") {
+		return rc
+	}
+	return c.base + strings.TrimPrefix(rc, "/")
+}
+
+// sampled determines whether a successful operation should be logged
+func (c *Client) sampled(op blob.Op) bool {
+	n := c.sample[op]
+	if n <= 1 {
+		return true
+	}
+	return (c.counts[op].Add(1)-1)%uint64(n) == 0
+}
+
+// outcome describes the outcome of a failed operation and produces the
+// least level at which it is logged
+func outcome(err error) (string, slog.Level) {
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		return OutcomeNotFound, slog.LevelWarn
+	case errors.Is(err, blob.ErrAborted):
+		return OutcomeAborted, slog.LevelWarn
+	case errors.Is(err, blob.ErrCanceled), errors.Is(err, context.Canceled):
+		return OutcomeCanceled, slog.LevelWarn
+	default:
+		return OutcomeError, slog.LevelError
+	}
+}
+
+// operation is a record which is logged once the operation it describes ends
+type operation struct {
+	client *Client
+	cxt    context.Context
+	op     blob.Op
+	attrs  []slog.Attr
+	start  time.Time
+	once   sync.Once
+}
+
+func (c *Client) begin(cxt context.Context, op blob.Op, attrs ...slog.Attr) *operation {
+	return &operation{
+		client: c,
+		cxt:    cxt,
+		op:     op,
+		attrs:  attrs,
+		start:  time.Now(),
+	}
+}
+
+// end logs an operation, which failed if err is not nil, with any further
+// attributes, unless it succeeded and is sampled out. Only the first call has
+// any effect.
+func (o *operation) end(err error, attrs ...slog.Attr) {
+	o.once.Do(func() {
+		d := time.Since(o.start)
+		level, ok := o.client.levels[o.op]
+		if !ok {
+			level = o.client.level
+		}
+		res := OutcomeOK
+		if err != nil {
+			var least slog.Level
+			res, least = outcome(err)
+			level = max(level, least)
+		} else if !o.client.sampled(o.op) {
+			return
+		}
+		if !o.client.log.Enabled(o.cxt, level) {
+			return
+		}
+		all := make([]slog.Attr, 0, len(o.attrs)+len(attrs)+3)
+		all = append(append(all, o.attrs...), attrs...)
+		all = append(all, slog.Duration("duration", d), slog.String("outcome", res))
+		if err != nil {
+			all = append(all, slog.String("error", err.Error()))
+		}
+		o.client.log.LogAttrs(o.cxt, level, string(o.op), all...)
+	})
+}
+
+func (c *Client) call(cxt context.Context, op blob.Op, f func() error, attrs ...slog.Attr) error {
+	o := c.begin(cxt, op, attrs...)
+	err := f()
+	o.end(err)
+	return err
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpInit, func() error {
+		return c.client.Init(cxt, opts...)
+	}, slog.String("url", c.base))
+}
+
+// Read reads a resource. It is logged once the reader is closed, with the
+// number of bytes read.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+	o := c.begin(cxt, blob.OpRead, slog.String("url", c.url(rc)))
+	r, err := c.client.Read(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &reader{r: r, op: o}, nil
+}
+
+type reader struct {
+	r   io.ReadCloser
+	op  *operation
+	n   int64
+	err error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *reader) Close() error {
+	err := r.r.Close()
+	if r.err != nil {
+		r.op.end(r.err, slog.Int64("bytes", r.n))
+	} else {
+		r.op.end(err, slog.Int64("bytes", r.n))
+	}
+	return err
+}
+
+// List lists resources. It is logged once the listing is consumed, fails, or
+// is closed, with the number of resources listed.
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	o := c.begin(cxt, blob.OpList, slog.String("url", c.url(rc)))
+	iter, err := c.client.List(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &lister{Iterator: iter, op: o}, nil
+}
+
+type lister struct {
+	siter.Iterator[blob.Resource]
+	op *operation
+	n  int
+}
+
+func (l *lister) Next() (blob.Resource, error) {
+	v, err := l.Iterator.Next()
+	if errors.Is(err, siter.ErrClosed) {
+		l.op.end(nil, slog.Int("count", l.n))
+	} else if errors.Is(err, siter.ErrCanceled) {
+		l.op.end(fmt.Errorf("%w: %w", blob.ErrCanceled, err), slog.Int("count", l.n))
+	} else if err != nil {
+		l.op.end(err, slog.Int("count", l.n))
+	} else {
+		l.n++
+	}
+	return v, err
+}
+
+func (l *lister) NextPageToken() string {
+	return blob.NextPageToken(l.Iterator)
+}
+
+func (l *lister) Close() {
+	l.Iterator.Close()
+	l.op.end(nil, slog.Int("count", l.n))
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (res blob.Resource, err error) {
+	err = c.call(cxt, blob.OpStat, func() error {
+		res, err = c.client.Stat(cxt, rc, opts...)
+		return err
+	}, slog.String("url", c.url(rc)))
+	return res, err
+}
+
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (u string, err error) {
+	err = c.call(cxt, blob.OpAccessor, func() error {
+		u, err = c.client.Accessor(cxt, rc, opts...)
+		return err
+	}, slog.String("url", c.url(rc)))
+	return u, err
+}
+
+// Write writes a resource. It is logged once the writer is closed or
+// aborted, with the number of bytes written.
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	o := c.begin(cxt, blob.OpWrite, slog.String("url", c.url(rc)))
+	w, err := c.client.Write(cxt, rc, opts...)
+	if err != nil {
+		o.end(err)
+		return nil, err
+	}
+	return &writer{Writer: w, op: o}, nil
+}
+
+type writer struct {
+	blob.Writer
+	op *operation
+	n  int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *writer) Abort(err error) error {
+	res := w.Writer.Abort(err)
+	w.op.end(fmt.Errorf("%w: %v", blob.ErrAborted, err), slog.Int64("bytes", w.n))
+	return res
+}
+
+func (w *writer) Close() error {
+	err := w.Writer.Close()
+	w.op.end(err, slog.Int64("bytes", w.n))
+	return err
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpCopy, func() error {
+		return c.client.Copy(cxt, src, dst, opts...)
+	}, slog.String("url", c.url(src)), slog.String("dst", c.url(dst)))
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpMove, func() error {
+		return c.client.Move(cxt, src, dst, opts...)
+	}, slog.String("url", c.url(src)), slog.String("dst", c.url(dst)))
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDelete, func() error {
+		return c.client.Delete(cxt, rc, opts...)
+	}, slog.String("url", c.url(rc)))
+}
+
+// DeleteMany is logged once for the whole batch, with the number of
+// resources in it rather than their URLs
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDeleteMany, func() error {
+		return blob.DeleteMany(cxt, c.client, urls, opts...)
+	}, slog.String("url", c.base), slog.Int("count", len(urls)))
+}
+
+// DeletePrefix is logged once, with the URL of the prefix
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	return c.call(cxt, blob.OpDeletePrefix, func() error {
+		return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+	}, slog.String("url", c.url(prefix)))
+}
+
+func (c *Client) String() string {
+	return fmt.Sprint(c.client)
+}
@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://logging")
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := &bytes.Buffer{}
+	store := NewWithConfig(backend, Config{
+		Logger: slog.New(NewContextHandler(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))),
+		Levels: map[blob.Op]slog.Level{blob.OpStat: slog.LevelDebug},
+		Sample: map[blob.Op]int{blob.OpRead: 3},
+	})
+
+	// records produces the records logged since it was last called
+	records := func() []map[string]any {
+		var res []map[string]any
+		dec := json.NewDecoder(buf)
+		for {
+			var e map[string]any
+			err := dec.Decode(&e)
+			if err == io.EOF {
+				break
+			} else if !assert.NoError(t, err) {
+				break
+			}
+			res = append(res, e)
+		}
+		buf.Reset()
+		return res
+	}
+	read := func(dsn string) (string, error) {
+		r, err := store.Read(cxt, dsn)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		return string(d), err
+	}
+
+	d1 := "Hello, this is the data."
+
+	// a write is logged once it is closed, with the context's attributes
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	w, err := store.Write(With(cxt, "request_id", "abc123"), dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.Len(t, records(), 0)
+		assert.NoError(t, w.Close())
+	}
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, "INFO", r[0]["level"])
+		assert.Equal(t, "write", r[0]["msg"])
+		assert.Equal(t, "mem://logging/file1", r[0]["url"])
+		assert.Equal(t, float64(len(d1)), r[0]["bytes"])
+		assert.Equal(t, OutcomeOK, r[0]["outcome"])
+		assert.Equal(t, "abc123", r[0]["request_id"])
+		assert.Contains(t, r[0], "duration")
+		assert.NotContains(t, r[0], "error")
+	}
+
+	// hot reads are sampled
+	fmt.Printf("<= %s\n", dsn)
+	for i := 0; i < 4; i++ {
+		d, err := read(dsn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, d1, d)
+		}
+	}
+	if r := records(); assert.Len(t, r, 2) {
+		assert.Equal(t, "read", r[0]["msg"])
+		assert.Equal(t, float64(len(d1)), r[0]["bytes"])
+	}
+
+	// failures are always logged, at no less than warn
+	dsn = "missing"
+	fmt.Printf("<= %s\n", dsn)
+	_, err = read(dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	if r := records(); assert.Len(t, r, 2) {
+		for _, e := range r {
+			assert.Equal(t, "WARN", e["level"])
+			assert.Equal(t, OutcomeNotFound, e["outcome"])
+			assert.Contains(t, e, "error")
+		}
+	}
+
+	// operations below the level of the logger are not logged
+	_, err = store.Stat(cxt, "file1")
+	assert.NoError(t, err)
+	assert.Len(t, records(), 0)
+
+	// an aborted write is logged as such
+	dsn = "aborted"
+	fmt.Printf("=> %s\n", dsn)
+	w, err = store.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+	}
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, OutcomeAborted, r[0]["outcome"])
+	}
+
+	// a listing is logged once it is consumed, with the number of resources
+	_, err = siter.CollectErr(store.List(cxt, ""))
+	assert.NoError(t, err)
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, "list", r[0]["msg"])
+		assert.Equal(t, float64(1), r[0]["count"])
+	}
+
+	// as are copies, with both resources
+	err = store.Copy(cxt, "file1", "file2")
+	assert.NoError(t, err)
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, "mem://logging/file1", r[0]["url"])
+		assert.Equal(t, "mem://logging/file2", r[0]["dst"])
+	}
+
+	// context attributes are logged outside of the logger's groups
+	grouped := slog.New(NewContextHandler(slog.NewJSONHandler(buf, nil))).With("a", "b").WithGroup("x")
+	grouped.InfoContext(With(cxt, "request_id", "abc123"), "grouped", "k", "v")
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, "abc123", r[0]["request_id"])
+		assert.Equal(t, "b", r[0]["a"])
+		assert.Equal(t, map[string]any{"k": "v"}, r[0]["x"])
+	}
+
+	// clean up
+	err = blob.DeletePrefix(cxt, store, "")
+	assert.NoError(t, err)
+	if r := records(); assert.Len(t, r, 1) {
+		assert.Equal(t, "delete prefix", r[0]["msg"])
+	}
+}
@@ -1,6 +1,36 @@
 package blob
 
-type ReadConfig struct{}
+import (
+	"net/url"
+	"time"
+)
+
+// DefaultExpiry is the period for which an accessor is valid if no expiry is
+// specified
+const DefaultExpiry = 15 * time.Minute
+
+type ReadConfig struct {
+	Offset     int64  // the offset at which to begin reading; a negative offset is relative to the end of the resource
+	Length     int64  // the maximum number of bytes to read; zero or less reads to the end of the resource
+	Delimiter  string // when listing, only resources up to the next delimiter after the prefix are produced
+	PageSize   int    // when listing, the maximum number of resources to produce; zero or less produces them all
+	PageToken  string // when listing, the token from which to resume a previous listing
+	Compressed bool   // read content as it is stored, without decoding its content encoding
+
+	Expiry                     time.Duration // the period for which an accessor is valid; zero uses DefaultExpiry
+	Method                     string        // the HTTP method an accessor permits; empty permits GET
+	ContentType                string        // the content type an upload accessor requires
+	ResponseContentDisposition string        // the Content-Disposition header with which an accessor is served
+	Query                      url.Values    // additional query parameters included in an accessor
+}
+
+// IsAccessorDefault determines whether a configuration describes the default
+// accessor: a GET request, valid for the default period, with no overrides.
+// Backends which cannot issue anything else use this to reject options they
+// are unable to honor.
+func (c ReadConfig) IsAccessorDefault() bool {
+	return c.Expiry == 0 && (c.Method == "" || c.Method == "GET") && c.ContentType == "" && c.ResponseContentDisposition == "" && len(c.Query) == 0
+}
 
 func (c ReadConfig) WithOptions(opts []ReadOption) ReadConfig {
 	for _, opt := range opts {
@@ -11,8 +41,127 @@ func (c ReadConfig) WithOptions(opts []ReadOption) ReadConfig {
 
 type ReadOption func(ReadConfig) ReadConfig
 
+// WithRange reads at most length bytes beginning at offset. A negative offset
+// is relative to the end of the resource; a length of zero or less reads to
+// the end of the resource.
+func WithRange(offset, length int64) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.Offset = offset
+		c.Length = length
+		return c
+	}
+}
+
+// WithOffset reads from offset to the end of the resource. A negative offset
+// is relative to the end of the resource.
+func WithOffset(offset int64) ReadOption {
+	return WithRange(offset, 0)
+}
+
+// WithReadCompressed reads a resource exactly as it is stored. Some backends
+// decode a resource which is stored with a content encoding such as gzip as
+// it is read; this option reads the encoded content instead. Backends which
+// never decode content ignore it.
+func WithReadCompressed() ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.Compressed = true
+		return c
+	}
+}
+
+// WithPageSize limits a listing to at most n resources. The token from which
+// to resume listing is obtained from the iterator via NextPageToken once the
+// page has been consumed.
+func WithPageSize(n int) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.PageSize = n
+		return c
+	}
+}
+
+// WithPageToken resumes a listing from where a previous page left off. The
+// listing must otherwise be made with the same prefix and options as the one
+// which produced the token.
+func WithPageToken(token string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.PageToken = token
+		return c
+	}
+}
+
+// WithDelimiter lists resources hierarchically. Rather than listing every
+// resource under a prefix, only its immediate children are listed; resources
+// which have the delimiter somewhere after the prefix are summarized by a
+// single Resource with IsPrefix set, whose URL extends up to and including
+// the delimiter, like a directory.
+func WithDelimiter(d string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.Delimiter = d
+		return c
+	}
+}
+
+// WithExpiry sets the period for which an accessor is valid
+func WithExpiry(d time.Duration) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.Expiry = d
+		return c
+	}
+}
+
+// WithMethod sets the HTTP method an accessor permits. For example, an
+// accessor that permits PUT may be used to upload a resource directly.
+func WithMethod(m string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.Method = m
+		return c
+	}
+}
+
+// WithRequiredContentType requires that an upload made via an accessor uses
+// the specified content type
+func WithRequiredContentType(t string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.ContentType = t
+		return c
+	}
+}
+
+// WithResponseContentDisposition sets the Content-Disposition header with
+// which a resource is served via an accessor; for example, to provide a
+// filename for a download.
+func WithResponseContentDisposition(v string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		c.ResponseContentDisposition = v
+		return c
+	}
+}
+
+// WithQueryParam includes an additional query parameter in an accessor. It
+// replaces any parameter of the same name set by other options, such as the
+// one which carries the response Content-Disposition.
+func WithQueryParam(name, value string) ReadOption {
+	return func(c ReadConfig) ReadConfig {
+		q := make(url.Values)
+		for k, v := range c.Query {
+			q[k] = v
+		}
+		q.Set(name, value)
+		c.Query = q
+		return c
+	}
+}
+
 type WriteConfig struct {
-	ContentType string
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	ContentLanguage    string
+	CacheControl       string
+	Metadata           map[string]string
+	IfNotExists        bool   // the operation only succeeds if the resource does not exist
+	IfMatch            string // the operation only succeeds if the resource exists and its ETag or generation matches
+	Concurrency        int    // the maximum number of concurrent operations in a bulk operation; zero uses DefaultConcurrency
 }
 
 func (c WriteConfig) WithOptions(opts []WriteOption) WriteConfig {
@@ -30,3 +179,70 @@ func WithContentType(t string) WriteOption {
 		return c
 	}
 }
+
+func WithContentEncoding(e string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.ContentEncoding = e
+		return c
+	}
+}
+
+func WithContentDisposition(d string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.ContentDisposition = d
+		return c
+	}
+}
+
+func WithContentLanguage(l string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.ContentLanguage = l
+		return c
+	}
+}
+
+func WithCacheControl(v string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.CacheControl = v
+		return c
+	}
+}
+
+// WithMetadata sets user-defined metadata on the resource. When a resource
+// is copied or moved, metadata provided this way replaces that of the source
+// resource rather than being merged with it.
+func WithMetadata(m map[string]string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.Metadata = m
+		return c
+	}
+}
+
+// WithIfNotExists requires that the resource being written does not already
+// exist; if it does, ErrPreconditionFailed is returned.
+func WithIfNotExists() WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.IfNotExists = true
+		return c
+	}
+}
+
+// WithIfMatch requires that the resource being written or deleted exists and
+// that its current version matches the one provided, which is either the
+// ETag of the resource or its generation in decimal; if it does not,
+// ErrPreconditionFailed is returned.
+func WithIfMatch(tag string) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.IfMatch = tag
+		return c
+	}
+}
+
+// WithConcurrency limits the number of operations a bulk operation, such as
+// DeleteMany, performs at once
+func WithConcurrency(n int) WriteOption {
+	return func(c WriteConfig) WriteConfig {
+		c.Concurrency = n
+		return c
+	}
+}
@@ -0,0 +1,49 @@
+package blob
+
+import (
+	"sync"
+
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// PageIterator iterates over a single page of a paginated listing. Once the
+// page has been consumed, NextPageToken produces a token from which a
+// subsequent listing can resume by way of WithPageToken.
+type PageIterator struct {
+	siter.Iterator[Resource]
+	lock  sync.Mutex
+	token string
+}
+
+func NewPageIterator(iter siter.Iterator[Resource]) *PageIterator {
+	return &PageIterator{Iterator: iter}
+}
+
+// SetNextPageToken is used by the producer of a page to record the token for
+// the page which follows it. It must be called before the underlying
+// iterator is closed.
+func (p *PageIterator) SetNextPageToken(token string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.token = token
+}
+
+// NextPageToken produces the token for the page which follows this one; if
+// there are no more pages, or if this page has not yet been consumed, the
+// token is empty.
+func (p *PageIterator) NextPageToken() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.token
+}
+
+// NextPageToken produces the token for the page which follows the one
+// produced by an iterator returned from Client.List. The iterator must be
+// consumed first. If there are no more pages, or if the iterator is not
+// paginated, the token is empty.
+func NextPageToken(iter siter.Iterator[Resource]) string {
+	if p, ok := iter.(interface{ NextPageToken() string }); ok {
+		return p.NextPageToken()
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package blob
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Factory creates a blob client for a DSN
+type Factory func(context.Context, string) (Client, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Factory)
+)
+
+// Register makes a backend available for DSNs with the specified scheme. As
+// with database/sql drivers, each backend calls this when its package is
+// initialized, so importing a backend is enough to make it available to
+// impl.New; it panics if the factory is nil or if a backend has already been
+// registered for the scheme.
+func Register(scheme string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if factory == nil {
+		panic("blob: nil factory registered for scheme: " + scheme)
+	}
+	if _, ok := registry[scheme]; ok {
+		panic("blob: scheme registered twice: " + scheme)
+	}
+	registry[scheme] = factory
+}
+
+// Lookup obtains the factory registered for the specified scheme, if any
+func Lookup(scheme string) (Factory, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	f, ok := registry[scheme]
+	return f, ok
+}
+
+// Schemes lists every scheme for which a backend is registered, in order
+func Schemes() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	s := make([]string, 0, len(registry))
+	for k := range registry {
+		s = append(s, k)
+	}
+	slices.Sort(s)
+	return s
+}
+
+// NewFactory adapts a backend's constructor to a Factory
+func NewFactory[C Client](f func(context.Context, string) (C, error)) Factory {
+	return func(cxt context.Context, dsn string) (Client, error) {
+		c, err := f(cxt, dsn)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
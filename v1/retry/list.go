@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// errChanged is produced when a listing can't be resumed because the
+// resources which precede where it left off have changed
+var errChanged = errors.New("Listing changed while it was resumed")
+
+// lister iterates over a listing, which it resumes if it fails with a
+// retryable error by listing again and skipping the resources it has
+// already produced
+type lister struct {
+	cxt    context.Context
+	client *Client
+	rc     string
+	opts   []blob.ReadOption
+	iter   siter.Iterator[blob.Resource]
+	count  int    // the number of resources produced so far
+	last   string // the URL of the last resource produced
+}
+
+func (l *lister) Meta() siter.Meta {
+	return l.iter.Meta()
+}
+
+func (l *lister) Next() (blob.Resource, error) {
+	start := time.Now()
+	v, err := l.iter.Next()
+	if err != nil && !siter.IsFinished(err) {
+		err = l.client.again(l.cxt, start, err, func() error {
+			err := l.resume()
+			if err != nil {
+				return err
+			}
+			v, err = l.iter.Next()
+			return err
+		})
+	}
+	if err != nil {
+		return blob.Resource{}, err
+	}
+	l.count++
+	l.last = v.URL
+	return v, nil
+}
+
+// resume lists again and skips the resources which were already produced.
+// If they aren't the same ones, the listing has changed and can't be
+// resumed.
+func (l *lister) resume() error {
+	iter, err := l.client.client.List(l.cxt, l.rc, l.opts...)
+	if err != nil {
+		return err
+	}
+	var v blob.Resource
+	for i := 0; i < l.count; i++ {
+		v, err = iter.Next()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if l.count > 0 && v.URL != l.last {
+		iter.Close()
+		return errChanged
+	}
+	l.iter.Close()
+	l.iter = iter
+	return nil
+}
+
+func (l *lister) NextPageToken() string {
+	return blob.NextPageToken(l.iter)
+}
+
+func (l *lister) Close() {
+	l.iter.Close()
+}
@@ -0,0 +1,310 @@
+// Package retry retries operations on any blob client which fail with
+// transient errors.
+//
+// Failed attempts are retried after an exponential backoff with full jitter,
+// until an operation succeeds, fails with an error which isn't retryable, or
+// exhausts its budget of attempts or time. Operations which only read are
+// always retried. Operations which modify resources are only retried when it
+// is safe to repeat them: a write is retried if its content was buffered so
+// that it can be replayed, and copies, moves, and deletes are retried if
+// they have a precondition.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultWriteBuffer    = 8 << 20
+)
+
+// Policy determines which operations that modify resources are retried
+type Policy int
+
+const (
+	// RetryConditional retries writes which can be replayed, and copies,
+	// moves, and deletes which have a precondition. Without one, repeating
+	// an operation which may already have taken effect could undo a change
+	// made by someone else in the meantime. This is the default.
+	RetryConditional Policy = iota
+	// RetryAlways retries writes which can be replayed, and every copy, move,
+	// and delete
+	RetryAlways
+	// RetryNever never retries operations which modify resources; writes are
+	// not buffered
+	RetryNever
+)
+
+type Config struct {
+	MaxAttempts    int                  // the maximum number of attempts at an operation; zero uses DefaultMaxAttempts
+	MaxElapsed     time.Duration        // the maximum time spent on an operation, after which it is not retried again; zero is limited only by the context
+	InitialBackoff time.Duration        // the backoff after the first failed attempt, which doubles after every attempt; zero uses DefaultInitialBackoff
+	MaxBackoff     time.Duration        // the maximum backoff between attempts; zero uses DefaultMaxBackoff
+	Retryable      func(err error) bool // determines whether an error is transient; nil uses Retryable
+	Policy         Policy               // which operations that modify resources are retried
+	WriteBuffer    int64                // the size up to which the content of a write is buffered in memory so it can be replayed; zero uses DefaultWriteBuffer, less than zero doesn't buffer
+	SpillDir       string               // the directory in which content which exceeds the write buffer is spilled to a temporary file so it can still be replayed; empty doesn't spill
+}
+
+// Client retries the operations it performs on the client it wraps
+type Client struct {
+	client         blob.Client
+	maxAttempts    int
+	maxElapsed     time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retryable      func(error) bool
+	policy         Policy
+	writeBuffer    int64
+	spillDir       string
+}
+
+func New(client blob.Client) *Client {
+	return NewWithConfig(client, Config{})
+}
+
+func NewWithConfig(client blob.Client, conf Config) *Client {
+	c := &Client{
+		client:         client,
+		maxAttempts:    conf.MaxAttempts,
+		maxElapsed:     conf.MaxElapsed,
+		initialBackoff: conf.InitialBackoff,
+		maxBackoff:     conf.MaxBackoff,
+		retryable:      conf.Retryable,
+		policy:         conf.Policy,
+		writeBuffer:    conf.WriteBuffer,
+		spillDir:       conf.SpillDir,
+	}
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = DefaultMaxAttempts
+	}
+	if c.initialBackoff <= 0 {
+		c.initialBackoff = DefaultInitialBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+	if c.retryable == nil {
+		c.retryable = Retryable
+	}
+	if c.writeBuffer == 0 {
+		c.writeBuffer = DefaultWriteBuffer
+	}
+	if c.policy == RetryNever {
+		c.writeBuffer, c.spillDir = -1, ""
+	}
+	return c
+}
+
+// Retryable determines whether an error is transient, such that the
+// operation which produced it may succeed if it is attempted again. This is
+// the case if the service was unavailable or overloaded, which includes 5xx
+// and 429 responses, if an established connection to it failed, if a
+// connection to it was refused, or if it timed out. Other network errors,
+// such as a host which can't be resolved, are likely to be mistakes in
+// configuration and are not retried.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, blob.ErrCanceled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, blob.ErrUnavailable) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" && errors.Is(op.Err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return dns.IsTimeout || dns.IsTemporary
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// backoff produces the period to wait after the specified attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.maxBackoff
+	if attempt < 32 {
+		d = min(c.initialBackoff<<(attempt-1), c.maxBackoff)
+	}
+	if d <= 0 {
+		d = c.maxBackoff // overflowed
+	}
+	return rand.N(d + 1)
+}
+
+// do performs an operation, retrying it while it fails with a retryable
+// error until its budget is exhausted or the context ends, in which case the
+// last error is produced
+func (c *Client) do(cxt context.Context, f func() error) error {
+	start := time.Now()
+	return c.again(cxt, start, f(), f)
+}
+
+// again retries an operation which began at the specified time and whose
+// first attempt produced the specified error, as with do
+func (c *Client) again(cxt context.Context, start time.Time, err error, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err == nil || attempt >= c.maxAttempts || !c.retryable(err) {
+			return err
+		}
+		d := c.backoff(attempt)
+		if c.maxElapsed > 0 && time.Since(start)+d > c.maxElapsed {
+			return err
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-cxt.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		err = f()
+	}
+}
+
+// retry performs an operation which produces a result as with do
+func retry[T any](cxt context.Context, c *Client, f func() (T, error)) (T, error) {
+	var res T
+	err := c.do(cxt, func() error {
+		var err error
+		res, err = f()
+		return err
+	})
+	return res, err
+}
+
+// conditional determines whether an operation which modifies a resource with
+// the specified options may be retried
+func (c *Client) conditional(opts []blob.WriteOption) bool {
+	switch c.policy {
+	case RetryAlways:
+		return true
+	case RetryConditional:
+		conf := blob.WriteConfig{}.WithOptions(opts)
+		return conf.IfMatch != "" || conf.IfNotExists
+	default:
+		return false
+	}
+}
+
+func (c *Client) Init(cxt context.Context, opts ...blob.WriteOption) error {
+	return c.do(cxt, func() error {
+		return c.client.Init(cxt, opts...)
+	})
+}
+
+// Read retries opening a resource. Once it has been opened, a failure while
+// it is being read is not retried.
+func (c *Client) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+	return retry(cxt, c, func() (io.ReadCloser, error) {
+		return c.client.Read(cxt, rc, opts...)
+	})
+}
+
+// List retries a listing, including one which fails after it has produced
+// some resources; it is resumed by listing again and skipping those which
+// were already produced, provided the listing hasn't changed in the meantime.
+func (c *Client) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	iter, err := retry(cxt, c, func() (siter.Iterator[blob.Resource], error) {
+		return c.client.List(cxt, rc, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lister{cxt: cxt, client: c, rc: rc, opts: opts, iter: iter}, nil
+}
+
+func (c *Client) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (blob.Resource, error) {
+	return retry(cxt, c, func() (blob.Resource, error) {
+		return c.client.Stat(cxt, rc, opts...)
+	})
+}
+
+func (c *Client) Accessor(cxt context.Context, rc string, opts ...blob.ReadOption) (string, error) {
+	return retry(cxt, c, func() (string, error) {
+		return c.client.Accessor(cxt, rc, opts...)
+	})
+}
+
+// Write buffers the content of a resource, up to the write buffer and then
+// in a spill file if there is a spill directory, and writes it once the
+// writer is closed, retrying as necessary. Content which exceeds what can be
+// buffered is written as it is received and is not retried.
+func (c *Client) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	if c.writeBuffer < 0 {
+		return c.client.Write(cxt, rc, opts...)
+	}
+	return &writer{cxt: cxt, client: c, rc: rc, opts: opts}, nil
+}
+
+func (c *Client) Copy(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	if !c.conditional(opts) {
+		return c.client.Copy(cxt, src, dst, opts...)
+	}
+	return c.do(cxt, func() error {
+		return c.client.Copy(cxt, src, dst, opts...)
+	})
+}
+
+func (c *Client) Move(cxt context.Context, src, dst string, opts ...blob.WriteOption) error {
+	if !c.conditional(opts) {
+		return c.client.Move(cxt, src, dst, opts...)
+	}
+	return c.do(cxt, func() error {
+		return c.client.Move(cxt, src, dst, opts...)
+	})
+}
+
+func (c *Client) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	if !c.conditional(opts) {
+		return c.client.Delete(cxt, rc, opts...)
+	}
+	return c.do(cxt, func() error {
+		return c.client.Delete(cxt, rc, opts...)
+	})
+}
+
+// DeleteMany retries the whole batch if any of it fails, according to the
+// same policy as Delete. Resources an earlier attempt deleted are gone by
+// then, which is not an error.
+func (c *Client) DeleteMany(cxt context.Context, urls []string, opts ...blob.WriteOption) error {
+	if !c.conditional(opts) {
+		return blob.DeleteMany(cxt, c.client, urls, opts...)
+	}
+	return c.do(cxt, func() error {
+		return blob.DeleteMany(cxt, c.client, urls, opts...)
+	})
+}
+
+// DeletePrefix is retried according to the same policy as Delete. Each
+// attempt starts over from whatever is left under the prefix.
+func (c *Client) DeletePrefix(cxt context.Context, prefix string, opts ...blob.WriteOption) error {
+	if !c.conditional(opts) {
+		return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+	}
+	return c.do(cxt, func() error {
+		return blob.DeletePrefix(cxt, c.client, prefix, opts...)
+	})
+}
+
+func (c *Client) String() string {
+	return fmt.Sprint(c.client)
+}
@@ -0,0 +1,286 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bww/go-blob/v1"
+	"github.com/bww/go-blob/v1/impl/mem"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// flaky fails operations on the client it wraps a specified number of times
+// before they succeed. Writes fail when they are closed and listings fail
+// after they have produced two resources.
+type flaky struct {
+	blob.Client
+	sync.Mutex
+	failures map[blob.Op]int
+	attempts map[blob.Op]int
+}
+
+func (f *flaky) set(op blob.Op, n int) {
+	f.Lock()
+	defer f.Unlock()
+	f.failures[op] = n
+	f.attempts[op] = 0
+}
+
+func (f *flaky) count(op blob.Op) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.attempts[op]
+}
+
+func (f *flaky) fail(op blob.Op, rc string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.attempts[op]++
+	if f.failures[op] > 0 {
+		f.failures[op]--
+		return blob.NewError(op, rc, blob.ErrUnavailable, errors.New("503 Service Unavailable"))
+	}
+	return nil
+}
+
+func (f *flaky) Read(cxt context.Context, rc string, opts ...blob.ReadOption) (io.ReadCloser, error) {
+	if err := f.fail(blob.OpRead, rc); err != nil {
+		return nil, err
+	}
+	return f.Client.Read(cxt, rc, opts...)
+}
+
+func (f *flaky) Stat(cxt context.Context, rc string, opts ...blob.ReadOption) (blob.Resource, error) {
+	if err := f.fail(blob.OpStat, rc); err != nil {
+		return blob.Resource{}, err
+	}
+	return f.Client.Stat(cxt, rc, opts...)
+}
+
+func (f *flaky) List(cxt context.Context, rc string, opts ...blob.ReadOption) (siter.Iterator[blob.Resource], error) {
+	res, err := siter.CollectErr(f.Client.List(cxt, rc, opts...))
+	if err != nil {
+		return nil, err
+	}
+	iter := siter.NewWithContext(cxt, make(chan siter.Result[blob.Resource], len(res)+1))
+	if err := f.fail(blob.OpList, rc); err != nil {
+		for _, e := range res[:min(2, len(res))] {
+			iter.Write(e)
+		}
+		iter.Cancel(err)
+		return iter, nil
+	}
+	for _, e := range res {
+		iter.Write(e)
+	}
+	iter.Close()
+	return iter, nil
+}
+
+func (f *flaky) Write(cxt context.Context, rc string, opts ...blob.WriteOption) (blob.Writer, error) {
+	w, err := f.Client.Write(cxt, rc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyWriter{Writer: w, flaky: f, rc: rc}, nil
+}
+
+func (f *flaky) Delete(cxt context.Context, rc string, opts ...blob.WriteOption) error {
+	if err := f.fail(blob.OpDelete, rc); err != nil {
+		return err
+	}
+	return f.Client.Delete(cxt, rc, opts...)
+}
+
+type flakyWriter struct {
+	blob.Writer
+	flaky *flaky
+	rc    string
+}
+
+func (w *flakyWriter) Close() error {
+	if err := w.flaky.fail(blob.OpWrite, w.rc); err != nil {
+		w.Writer.Abort(err)
+		return err
+	}
+	return w.Writer.Close()
+}
+
+func TestRetry(t *testing.T) {
+	var dsn string
+
+	cxt, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	backend, err := mem.New(cxt, "mem://retry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	origin := &flaky{Client: backend, failures: make(map[blob.Op]int), attempts: make(map[blob.Op]int)}
+	conf := Config{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond * 5,
+		WriteBuffer:    64,
+	}
+	store := NewWithConfig(origin, conf)
+
+	read := func(c blob.Client, dsn string, opts ...blob.ReadOption) (string, error) {
+		r, err := c.Read(cxt, dsn, opts...)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		d, err := io.ReadAll(r)
+		return string(d), err
+	}
+	write := func(c blob.Client, dsn, data string, opts ...blob.WriteOption) error {
+		w, err := c.Write(cxt, dsn, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(data))
+		if err != nil {
+			w.Abort(err)
+			return err
+		}
+		return w.Close()
+	}
+
+	d1 := "Hello, this is the data."
+	d2 := "Hello, this is the data, which is rather larger than the write buffer."
+
+	// a buffered write is replayed until it succeeds
+	dsn = "file1"
+	fmt.Printf("=> %s\n", dsn)
+	origin.set(blob.OpWrite, 2)
+	assert.NoError(t, write(store, dsn, d1))
+	assert.Equal(t, 3, origin.count(blob.OpWrite))
+
+	// reads are retried until they succeed, or until they run out of attempts
+	fmt.Printf("<= %s\n", dsn)
+	origin.set(blob.OpStat, 2)
+	_, err = store.Stat(cxt, dsn)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, origin.count(blob.OpStat))
+	origin.set(blob.OpRead, 1)
+	d, err := read(store, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d1, d)
+	}
+	assert.Equal(t, 2, origin.count(blob.OpRead))
+	origin.set(blob.OpStat, 10)
+	_, err = store.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrUnavailable)
+	assert.Equal(t, 3, origin.count(blob.OpStat))
+
+	// errors which aren't transient aren't retried
+	origin.set(blob.OpStat, 0)
+	_, err = store.Stat(cxt, "missing")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+	assert.Equal(t, 1, origin.count(blob.OpStat))
+
+	// nor is a write which outgrew its buffer, unless it can spill
+	dsn = "file2"
+	fmt.Printf("=> %s\n", dsn)
+	origin.set(blob.OpWrite, 1)
+	assert.ErrorIs(t, write(store, dsn, d2), blob.ErrUnavailable)
+	assert.Equal(t, 1, origin.count(blob.OpWrite))
+	_, err = backend.Stat(cxt, dsn)
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	spill := t.TempDir()
+	spilling := NewWithConfig(origin, Config{MaxAttempts: 3, InitialBackoff: time.Millisecond, WriteBuffer: 8, SpillDir: spill})
+	origin.set(blob.OpWrite, 1)
+	assert.NoError(t, write(spilling, dsn, d2))
+	assert.Equal(t, 2, origin.count(blob.OpWrite))
+	d, err = read(backend, dsn)
+	if assert.NoError(t, err) {
+		assert.Equal(t, d2, d)
+	}
+	files, err := os.ReadDir(spill)
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 0)
+	}
+
+	// an aborted write stores nothing
+	dsn = "aborted"
+	w, err := store.Write(cxt, dsn)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte(d1))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Abort(fmt.Errorf("the producer failed")))
+		assert.ErrorIs(t, w.Close(), blob.ErrAborted)
+		_, err = store.Stat(cxt, dsn)
+		assert.ErrorIs(t, err, blob.ErrNotFound)
+	}
+
+	// a delete is only retried if it has a precondition
+	dsn = "file2"
+	fmt.Printf("~~ %s\n", dsn)
+	origin.set(blob.OpDelete, 1)
+	assert.ErrorIs(t, store.Delete(cxt, dsn), blob.ErrUnavailable)
+	assert.Equal(t, 1, origin.count(blob.OpDelete))
+	res, err := store.Stat(cxt, dsn)
+	if assert.NoError(t, err) {
+		origin.set(blob.OpDelete, 1)
+		assert.NoError(t, store.Delete(cxt, dsn, blob.WithIfMatch(res.ETag)))
+		assert.Equal(t, 2, origin.count(blob.OpDelete))
+	}
+
+	// a listing which fails part of the way through is resumed
+	for _, e := range []string{"list/a", "list/b", "list/c", "list/d"} {
+		assert.NoError(t, write(store, e, d1))
+	}
+	fmt.Printf("<= %s\n", "list/")
+	origin.set(blob.OpList, 2)
+	all, err := siter.CollectErr(store.List(cxt, "list/"))
+	if assert.NoError(t, err) {
+		var urls []string
+		for _, e := range all {
+			urls = append(urls, e.URL)
+		}
+		assert.Equal(t, []string{"mem://retry/list/a", "mem://retry/list/b", "mem://retry/list/c", "mem://retry/list/d"}, urls)
+	}
+	assert.Equal(t, 3, origin.count(blob.OpList))
+
+	// retrying ends with the context
+	short, stop := context.WithTimeout(cxt, time.Millisecond*50)
+	defer stop()
+	patient := NewWithConfig(origin, Config{MaxAttempts: 100, InitialBackoff: time.Second})
+	origin.set(blob.OpStat, 100)
+	start := time.Now()
+	_, err = patient.Stat(short, "file1")
+	assert.ErrorIs(t, err, blob.ErrUnavailable)
+	assert.Less(t, time.Since(start), time.Second)
+	origin.set(blob.OpStat, 0)
+
+	// transient errors are distinguished from others
+	for e, expect := range map[error]bool{
+		blob.NewError(blob.OpRead, "a", blob.ErrUnavailable, errors.New("429 Too Many Requests")):                    true,
+		fmt.Errorf("read: %w", syscall.ECONNRESET):                                                                   true,
+		&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}:                                                          true,
+		&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}: false,
+		&net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}}:       true,
+		&net.OpError{Op: "dial", Err: syscall.EHOSTUNREACH}:                                                          false,
+		io.ErrUnexpectedEOF: true,
+		blob.ErrNotFound:    false,
+		blob.NewError(blob.OpRead, "a", blob.ErrPermission, errors.New("403 Forbidden")): false,
+		context.Canceled: false,
+	} {
+		assert.Equal(t, expect, Retryable(e), "%v", e)
+	}
+
+	// clean up
+	err = blob.DeletePrefix(cxt, store, "")
+	assert.NoError(t, err)
+}
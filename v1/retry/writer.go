@@ -0,0 +1,125 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/bww/go-blob/v1"
+)
+
+// writer buffers the content of a resource so that it can be replayed, and
+// writes it once it is closed. If the content outgrows what can be buffered,
+// the writer falls back to writing it as it is received.
+type writer struct {
+	cxt    context.Context
+	client *Client
+	rc     string
+	opts   []blob.WriteOption
+	buf    bytes.Buffer
+	spill  *os.File    // content which exceeds the buffer, if any
+	w      blob.Writer // the underlying writer, once content is written as it is received
+	err    error
+	closed bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.w != nil {
+		return w.w.Write(p)
+	}
+	if w.spill != nil {
+		return w.spill.Write(p)
+	}
+	if int64(w.buf.Len()+len(p)) <= w.client.writeBuffer {
+		return w.buf.Write(p)
+	}
+	if w.client.spillDir != "" {
+		w.spill, w.err = os.CreateTemp(w.client.spillDir, "blob-retry-*")
+		if w.err != nil {
+			return 0, w.err
+		}
+		return w.spill.Write(p)
+	}
+
+	// the content can't be replayed, so write it as it is received
+	w.w, w.err = retry(w.cxt, w.client, func() (blob.Writer, error) {
+		return w.client.client.Write(w.cxt, w.rc, w.opts...)
+	})
+	if w.err != nil {
+		return 0, w.err
+	}
+	_, w.err = w.w.Write(w.buf.Bytes())
+	w.buf = bytes.Buffer{}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.w.Write(p)
+}
+
+// Abort discards the resource along with the content buffered to retry it
+func (w *writer) Abort(err error) error {
+	if w.closed {
+		return nil
+	}
+	if w.err == nil {
+		w.err = blob.ErrAborted
+	}
+	w.discard()
+	if w.w != nil {
+		return w.w.Abort(err)
+	}
+	return nil
+}
+
+// Close writes the buffered content, retrying as necessary, and completes
+// the resource
+func (w *writer) Close() error {
+	defer w.discard()
+	if w.w != nil {
+		return w.w.Close()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return nil
+	}
+	w.err = w.client.do(w.cxt, w.replay)
+	if w.err != nil {
+		return w.err
+	}
+	w.closed = true
+	return nil
+}
+
+// replay makes one attempt at writing the buffered content
+func (w *writer) replay() error {
+	var src io.Reader = bytes.NewReader(w.buf.Bytes())
+	if w.spill != nil {
+		src = io.MultiReader(src, io.NewSectionReader(w.spill, 0, 1<<63-1))
+	}
+	d, err := w.client.client.Write(w.cxt, w.rc, w.opts...)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(d, src)
+	if err != nil {
+		d.Abort(err)
+		return err
+	}
+	return d.Close()
+}
+
+// discard releases the buffered content
+func (w *writer) discard() {
+	w.buf = bytes.Buffer{}
+	if w.spill != nil {
+		w.spill.Close()
+		os.Remove(w.spill.Name())
+		w.spill = nil
+	}
+}